@@ -0,0 +1,110 @@
+// alphabet.go
+// Package lzhuff provides the alphabets the Huffman stage codes Values with. Like in DEFLATE
+// (RFC 1951), literal bytes, match lengths and the end-of-block marker share one alphabet, and
+// match distances, whose statistics are unrelated, get an alphabet and a code table of their own.
+// Lengths and distances span wide ranges, so they are grouped into buckets whose symbol is
+// Huffman coded and whose offset within the bucket follows as raw extra bits.
+
+package lzhuff
+
+import "math/bits"
+
+// extraCode maps positive integers starting at first onto symbols followed by extra bits.
+// The first 2<<k values get a symbol of their own. Every following power-of-two range of values
+// is split into 1<<k buckets of equal size, so the number of extra bits grows by one every 1<<k
+// symbols. DEFLATE uses k = 2 for match lengths and k = 1 for distances.
+type extraCode struct {
+	first   int // Smallest value that can be coded.
+	last    int // Largest value that can be coded.
+	k       int // Base-2 logarithm of the number of buckets per power of two.
+	symbols int // Number of symbols of the alphabet.
+}
+
+// newExtraCode returns the extraCode for the values first to last.
+func newExtraCode(first, last, k int) extraCode {
+	c := extraCode{first: first, last: last, k: k}
+	sym, _, _ := c.encode(last)
+	c.symbols = sym + 1
+	return c
+}
+
+// encode returns the symbol of v and the extra bits identifying v within its bucket.
+// Returns:
+// - sym: The symbol of the bucket holding v.
+// - extra: The offset of v within the bucket.
+// - extraBits: The number of extra bits.
+func (c extraCode) encode(v int) (int, uint64, byte) {
+	v -= c.first
+	n := 1 << c.k
+	if v < 2*n {
+		return v, 0, 0
+	}
+	extraBits := bits.Len(uint(v)) - 1 - c.k
+	sym := 2*n + (extraBits-1)*n + (v>>extraBits - n)
+	return sym, uint64(v) & (1<<extraBits - 1), byte(extraBits)
+}
+
+// bucket returns the smallest value of the bucket of sym and the number of its extra bits.
+func (c extraCode) bucket(sym int) (int, byte) {
+	n := 1 << c.k
+	if sym < 2*n {
+		return c.first + sym, 0
+	}
+	extraBits := (sym-2*n)/n + 1
+	return c.first + (n+(sym-2*n)%n)<<extraBits, byte(extraBits)
+}
+
+// Alphabets of the Huffman stage.
+var (
+	// lengthCode codes match lengths 1 to MaxMatchLength, as the symbols after litLenEOB of
+	// the literal/length alphabet.
+	lengthCode = newExtraCode(1, MaxMatchLength, 2)
+	// distanceCode codes match distances 1 to MaxSearchSize.
+	distanceCode = newExtraCode(1, MaxSearchSize, 1)
+)
+
+// litLenEOB is the symbol of the literal/length alphabet that marks the end of a block.
+// Symbols 0 to 255 are the literal bytes, and the symbols of match lengths follow litLenEOB,
+// so whether a Value is a literal or a pointer costs no bit of its own.
+const litLenEOB = 256
+
+// litLenSymbols is the size of the literal/length alphabet.
+var litLenSymbols = litLenEOB + 1 + lengthCode.symbols
+
+// lengthSymbol returns the symbol of the literal/length alphabet for a match of length bytes,
+// and its extra bits.
+func lengthSymbol(length int) (int, uint64, byte) {
+	sym, extra, extraBits := lengthCode.encode(length)
+	return litLenEOB + 1 + sym, extra, extraBits
+}
+
+// symbolFrequencies counts how often every symbol of the two alphabets occurs when values and
+// the end-of-block marker are encoded.
+// Parameters:
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+// Returns:
+// - The frequencies of the literal/length symbols in every context, indexed by context and
+// symbol; a single context without contexts.
+// - The frequencies of the distance symbols, indexed by symbol.
+func symbolFrequencies(values []Value, contexts []byte) ([][]int, []int) {
+	litLen := make([][]int, contextCount(contexts))
+	for ctx := range litLen {
+		litLen[ctx] = make([]int, litLenSymbols)
+	}
+	distances := make([]int, distanceSymbols)
+	reps := newRepDistances()
+	for i, v := range values {
+		freqs := litLen[contextOf(contexts, i)]
+		if v.IsLiteral {
+			freqs[v.val]++
+			continue
+		}
+		lsym, _, _ := lengthSymbol(int(v.length))
+		freqs[lsym]++
+		dsym, _, _ := reps.encode(int(v.distance))
+		distances[dsym]++
+	}
+	litLen[contextOf(contexts, len(values))][litLenEOB]++
+	return litLen, distances
+}
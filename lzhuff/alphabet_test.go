@@ -0,0 +1,87 @@
+// alphabet_test.go
+// Package lzhuff contains tests for the literal/length and distance alphabets.
+// These tests verify that every value maps onto a bucket symbol and extra bits that restore it.
+
+package lzhuff
+
+import "testing"
+
+// Test_extraCode tests that every value of the length and distance codes is restored from its
+// symbol and extra bits, and that the alphabets have the expected sizes.
+func Test_extraCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        extraCode
+		wantSymbols int
+	}{
+		{name: "Lengths", code: lengthCode, wantSymbols: 60},
+		{name: "Distances", code: distanceCode, wantSymbols: 48},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			if tt.code.symbols != tt.wantSymbols {
+				t.Errorf("symbols = %d; want %d", tt.code.symbols, tt.wantSymbols)
+			}
+			prevSym := 0
+			for v := tt.code.first; v <= tt.code.last; v++ {
+				sym, extra, extraBits := tt.code.encode(v)
+				if sym < prevSym || sym >= tt.code.symbols {
+					t.Fatalf("encode(%d) symbol = %d; previous symbol %d, %d symbols", v, sym, prevSym, tt.code.symbols)
+				}
+				prevSym = sym
+				if extra >= 1<<extraBits {
+					t.Fatalf("encode(%d) extra = %d does not fit into %d bits", v, extra, extraBits)
+				}
+				base, baseBits := tt.code.bucket(sym)
+				if baseBits != extraBits || base+int(extra) != v {
+					t.Fatalf("bucket(%d) = %d, %d bits; encode(%d) has extra %d in %d bits", sym, base, baseBits, v, extra, extraBits)
+				}
+			}
+		})
+	}
+}
+
+// Test_symbolFrequencies tests that literals, match lengths and the end-of-block marker are
+// counted in the literal/length alphabet and distances in the distance alphabet, and that
+// contexts split the literal/length counts.
+func Test_symbolFrequencies(t *testing.T) {
+	values := []Value{
+		NewValue(true, 'a', 0, 0),
+		NewValue(true, 'a', 0, 0),
+		NewValue(false, 0, MaxMatchLength, 1),
+		NewValue(false, 0, 4, MaxSearchSize),
+	}
+	contexts, _ := symbolFrequencies(values, []byte{contextSpace, contextLetter, contextLetter, contextDigit, contextOther})
+	litLen, distances := symbolFrequencies(values, nil)
+
+	if len(litLen) != 1 || len(litLen[0]) != 317 || len(distances) != 51 {
+		t.Fatalf("alphabets have %d and %d symbols; want 317 and 51", len(litLen[0]), len(distances))
+	}
+	wantLitLen := map[int]int{'a': 2, litLenEOB: 1, litLenSymbols - 1: 1, litLenEOB + 4: 1}
+	for sym, freq := range litLen[0] {
+		var inContexts int
+		for _, freqs := range contexts {
+			inContexts += freqs[sym]
+		}
+		if inContexts != freq {
+			t.Errorf("literal/length symbol %d has frequency %d across contexts; want %d", sym, inContexts, freq)
+		}
+		if freq != wantLitLen[sym] {
+			t.Errorf("literal/length symbol %d has frequency %d; want %d", sym, freq, wantLitLen[sym])
+		}
+	}
+	if contexts[contextLetter]['a'] != 1 || contexts[contextOther][litLenEOB] != 1 {
+		t.Errorf("literal/length symbols are not counted in their contexts")
+	}
+	// Distance 1 is the most recent distance a block starts with.
+	wantDistances := map[int]int{0: 1, distanceSymbols - 1: 1}
+	for sym, freq := range distances {
+		if freq != wantDistances[sym] {
+			t.Errorf("distance symbol %d has frequency %d; want %d", sym, freq, wantDistances[sym])
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// bitreader.go
+// Package lzhuff provides the bit reader the decoder reads compressed streams with. It reads the
+// bit order of bitio.Writer, most significant bit first, and unlike bitio.Reader it can look ahead
+// at bits without consuming them, which table-driven Huffman decoding relies on. It can also read
+// the bit order of DEFLATE, least significant bit first, by reversing every byte as it is
+// buffered: Huffman codes then read first bit first as in the format of this package, and only
+// the numeric fields of DEFLATE need reversing, which readLSB does.
+
+package lzhuff
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+)
+
+// bitReader reads a bit stream written by bitio.Writer.
+type bitReader struct {
+	r   io.ByteReader // Source of the stream.
+	buf uint64        // Buffered bits, left-aligned: the next bit is the most significant one.
+	n   byte          // Number of valid bits in buf.
+	err error         // Error that stopped filling buf, returned once the buffered bits run out.
+	lsb bool          // Whether the stream fills every byte starting with its least significant bit.
+}
+
+// newBitReader creates a bitReader reading from r, buffering r unless it is an io.ByteReader.
+func newBitReader(r io.Reader) *bitReader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &bitReader{r: br}
+}
+
+// newLSBBitReader creates a bitReader reading a stream in the bit order of DEFLATE from r.
+func newLSBBitReader(r io.Reader) *bitReader {
+	b := newBitReader(r)
+	b.lsb = true
+	return b
+}
+
+// fill buffers whole bytes until buf cannot take another one or the source fails.
+func (b *bitReader) fill() {
+	for b.n <= 56 && b.err == nil {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			b.err = err
+			return
+		}
+		if b.lsb {
+			c = bits.Reverse8(c)
+		}
+		b.buf |= uint64(c) << (56 - b.n)
+		b.n += 8
+	}
+}
+
+// peek returns the next n bits without consuming them, n being at most 57. Bits beyond the end
+// of the stream read as zeros.
+// Returns:
+// - The bits, the first one being the most significant.
+// - The number of buffered bits, which is less than n only at the end of the stream.
+func (b *bitReader) peek(n byte) (uint64, byte) {
+	if b.n < n {
+		b.fill()
+	}
+	return b.buf >> (64 - n), b.n
+}
+
+// consume drops n bits that have been peeked.
+func (b *bitReader) consume(n byte) {
+	b.buf <<= n
+	b.n -= n
+}
+
+// shortRead returns the error for a read that the buffered bits cannot satisfy: io.EOF if the
+// stream ended on the read boundary, io.ErrUnexpectedEOF if it ended within the read.
+func (b *bitReader) shortRead() error {
+	if b.err == io.EOF && b.n > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return b.err
+}
+
+// ReadBits reads n bits, n being at most 64, and returns them with the first one being the most
+// significant.
+func (b *bitReader) ReadBits(n byte) (uint64, error) {
+	if n > 56 {
+		hi, err := b.ReadBits(n - 32)
+		if err != nil {
+			return 0, err
+		}
+		lo, err := b.ReadBits(32)
+		if err != nil {
+			return 0, err
+		}
+		return hi<<32 | lo, nil
+	}
+	v, avail := b.peek(n)
+	if avail < n {
+		return 0, b.shortRead()
+	}
+	b.consume(n)
+	return v, nil
+}
+
+// readLSB reads an n-bit number stored least significant bit first, as DEFLATE stores every
+// field but Huffman codes.
+func (b *bitReader) readLSB(n byte) (uint64, error) {
+	v, err := b.ReadBits(n)
+	return bits.Reverse64(v) >> (64 - n), err
+}
+
+// ReadBool reads a single bit.
+func (b *bitReader) ReadBool() (bool, error) {
+	bit, err := b.ReadBits(1)
+	return bit == 1, err
+}
+
+// Align skips the bits left in the current byte, so the next read starts on a byte boundary.
+func (b *bitReader) Align() {
+	b.consume(b.n % 8)
+}
+
+// Read reads whole bytes after Align, first from the buffered bits and then from the source.
+// The bytes are those of the stream, in either bit order. It implements io.Reader.
+func (b *bitReader) Read(p []byte) (int, error) {
+	n := 0
+	for ; n < len(p) && b.n >= 8; n++ {
+		p[n] = byte(b.buf >> 56)
+		if b.lsb {
+			p[n] = bits.Reverse8(p[n])
+		}
+		b.consume(8)
+	}
+	for ; n < len(p) && b.err == nil; n++ {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			b.err = err
+			break
+		}
+		p[n] = c
+	}
+	if n == 0 && len(p) > 0 {
+		return 0, b.err
+	}
+	return n, nil
+}
+
+// ReadByte reads the next 8 bits, as a byte of the stream in either bit order. It implements
+// io.ByteReader.
+func (b *bitReader) ReadByte() (byte, error) {
+	if b.lsb {
+		v, err := b.readLSB(8)
+		return byte(v), err
+	}
+	v, err := b.ReadBits(8)
+	return byte(v), err
+}
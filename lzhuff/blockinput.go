@@ -0,0 +1,53 @@
+// blockinput.go
+// Package lzhuff provides the input buffering shared by the block-based encoders. The input is
+// collected until a full block is pending, and once a block is compressed only the tail that the
+// pointers of later blocks may refer to is kept, so memory use is bounded by the block size and
+// the search window regardless of the length of the input.
+
+package lzhuff
+
+// blockInput holds the sliding window of a block-based encoder.
+type blockInput struct {
+	buf       []byte // History followed by the input not compressed yet.
+	history   int    // Number of bytes at the start of buf that were already compressed.
+	blockSize int    // Length of the input of every block but the last.
+}
+
+// pending returns the number of bytes collected but not compressed yet.
+func (b *blockInput) pending() int {
+	return len(b.buf) - b.history
+}
+
+// write collects p, calling flush every time a full block is pending and more input arrives.
+// A full block stays pending until then, so the final block is never empty unless the whole
+// stream is.
+// Parameters:
+// - p: The input to collect.
+// - flush: Compresses the given number of pending bytes as one block and slides the window.
+// Returns:
+// - The number of bytes of p collected, and the first error returned by flush.
+func (b *blockInput) write(p []byte, flush func(n int) error) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		pending := b.pending()
+		if pending == b.blockSize {
+			if err := flush(pending); err != nil {
+				return written, err
+			}
+			continue
+		}
+		n := min(len(p), b.blockSize-pending)
+		b.buf = append(b.buf, p[:n]...)
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// slide drops the input up to end once it is compressed, keeping its last window bytes as
+// history for the next block, followed by the input still pending.
+func (b *blockInput) slide(end, window int) {
+	keep := min(end, window)
+	b.buf = b.buf[:copy(b.buf, b.buf[end-keep:])]
+	b.history = keep
+}
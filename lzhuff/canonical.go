@@ -0,0 +1,299 @@
+// canonical.go
+// Package lzhuff provides canonical Huffman code assignment and the compact serialization of code
+// tables. A canonical code is fully determined by the code length of every symbol, so a table is
+// stored as a list of lengths only. Like in DEFLATE (RFC 1951), the list is run-length encoded and
+// the resulting code-length symbols are themselves Huffman coded, with the lengths of that
+// code-length code stored first.
+
+package lzhuff
+
+import (
+	"fmt"
+
+	"github.com/icza/bitio"
+)
+
+// maxCodeBits is the length of the longest Huffman code a serialized table can describe.
+const maxCodeBits = 63
+
+// Symbols of the code-length alphabet used to serialize code lengths.
+// Symbols 0 to 15 stand for the code length of the same value.
+const (
+	clRepeat    = 16 // Repeat the previous code length 3 to 6 times; 2 extra bits.
+	clZeros     = 17 // Repeat the code length 0 3 to 10 times; 3 extra bits.
+	clZerosLong = 18 // Repeat the code length 0 11 to 138 times; 7 extra bits.
+	clLong      = 19 // A single code length of 16 to 63; 6 extra bits hold the length minus 16.
+
+	clSymbols = 20 // Size of the code-length alphabet.
+)
+
+// clExtraBits is the number of extra bits following every code-length symbol.
+var clExtraBits = [clSymbols]byte{clRepeat: 2, clZeros: 3, clZerosLong: 7, clLong: 6}
+
+// clOrder is the order in which the lengths of the code-length code are stored. Symbols that are
+// rarely used come last, so trailing zero lengths can be omitted.
+var clOrder = [clSymbols]byte{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15, 19}
+
+// Sizes of the fields of a serialized table.
+const (
+	clCountBits  = 5 // Number of stored code-length code lengths, minus 4.
+	clLengthBits = 4 // Every code length of the code-length code.
+	clMinCount   = 4 // Smallest number of stored code-length code lengths.
+)
+
+// clToken is one code-length symbol of a serialized table together with its extra bits.
+type clToken struct {
+	sym   byte // Code-length symbol.
+	extra byte // Value of the extra bits of sym.
+}
+
+// codeLengths stores the depth of every leaf below n in lengths, indexed by the leaf value.
+// Parameters:
+// - depth: The depth of n in the tree.
+// - lengths: The code lengths to fill.
+func (n *Node) codeLengths(depth int, lengths []byte) {
+	if n.isLeaf {
+		// A tree with a single leaf still needs a one-bit code so the reader can consume it.
+		lengths[n.value] = byte(max(depth, 1))
+		return
+	}
+	if n.Left != nil {
+		n.Left.codeLengths(depth+1, lengths)
+	}
+	if n.Right != nil {
+		n.Right.codeLengths(depth+1, lengths)
+	}
+}
+
+// canonicalCodes assigns the canonical Huffman code to every symbol with a non-zero length.
+// Shorter codes precede longer ones, and codes of the same length are assigned in symbol order,
+// as described in RFC 1951 section 3.2.2.
+// Parameters:
+// - lengths: The code length of every symbol; 0 means the symbol has no code.
+// Returns:
+// - The code of every symbol, with a zero-length Code for symbols without one.
+func canonicalCodes(lengths []byte) []Code {
+	var count [maxCodeBits + 1]uint64
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+
+	var next [maxCodeBits + 1]uint64
+	code := uint64(0)
+	for bits := 1; bits <= maxCodeBits; bits++ {
+		code = (code + count[bits-1]) << 1
+		next[bits] = code
+	}
+
+	codes := make([]Code, len(lengths))
+	for sym, l := range lengths {
+		if l != 0 {
+			codes[sym] = Code{c: next[l], bits: l}
+			next[l]++
+		}
+	}
+	return codes
+}
+
+// checkCodeLengths reports whether lengths describe a usable prefix code: no code is longer than
+// maxCodeBits, and the codes do not oversubscribe the code space. Incomplete codes, such as a
+// single one-bit code, are accepted, and so is an empty code for an alphabet without occurrences.
+// Returns:
+// - An error wrapping ErrCorruptTable if the lengths cannot be used.
+func checkCodeLengths(lengths []byte) error {
+	var count [maxCodeBits + 1]uint64
+	for sym, l := range lengths {
+		if l > maxCodeBits {
+			return fmt.Errorf("checkCodeLengths: code for %d is %d bits long: %w", sym, l, ErrCorruptTable)
+		}
+		count[l]++
+	}
+
+	// left is the number of unused codes of the current length.
+	left := uint64(1)
+	for bits := 1; bits <= maxCodeBits; bits++ {
+		left <<= 1
+		if count[bits] > left {
+			return fmt.Errorf("checkCodeLengths: %d codes of %d bits oversubscribe the code space: %w", count[bits], bits, ErrCorruptTable)
+		}
+		left -= count[bits]
+	}
+	return nil
+}
+
+// encodeCodeLengths run-length encodes lengths into code-length symbols.
+// Runs of zeros use clZeros and clZerosLong, runs of other lengths use clRepeat after the first
+// occurrence, and lengths above 15 use clLong.
+func encodeCodeLengths(lengths []byte) []clToken {
+	var tokens []clToken
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+
+		if l == 0 && run >= 3 {
+			run = min(run, 138)
+			if run >= 11 {
+				tokens = append(tokens, clToken{sym: clZerosLong, extra: byte(run - 11)})
+			} else {
+				tokens = append(tokens, clToken{sym: clZeros, extra: byte(run - 3)})
+			}
+			i += run
+			continue
+		}
+
+		if l > 15 {
+			tokens = append(tokens, clToken{sym: clLong, extra: l - 16})
+		} else {
+			tokens = append(tokens, clToken{sym: l})
+		}
+		i++
+		run--
+		if l == 0 {
+			continue
+		}
+		for run >= 3 {
+			repeat := min(run, 6)
+			tokens = append(tokens, clToken{sym: clRepeat, extra: byte(repeat - 3)})
+			i += repeat
+			run -= repeat
+		}
+	}
+	return tokens
+}
+
+// lengthTable is the serialized form of a list of code lengths.
+type lengthTable struct {
+	tokens    []clToken       // Run-length encoded code lengths.
+	clLengths [clSymbols]byte // Code lengths of the code-length code.
+	clCodes   []Code          // Canonical code-length code.
+	count     int             // Number of code-length code lengths stored, in clOrder.
+}
+
+// newLengthTable prepares the serialization of lengths.
+func newLengthTable(lengths []byte) *lengthTable {
+	lt := &lengthTable{tokens: encodeCodeLengths(lengths)}
+
+	freqs := make([]int, clSymbols)
+	for _, tok := range lt.tokens {
+		freqs[tok.sym]++
+	}
+	buildHuffmanTree(freqs).limitedCodeLengths(lt.clLengths[:], 1<<clLengthBits-1)
+	lt.clCodes = canonicalCodes(lt.clLengths[:])
+
+	lt.count = clSymbols
+	for lt.count > clMinCount && lt.clLengths[clOrder[lt.count-1]] == 0 {
+		lt.count--
+	}
+	return lt
+}
+
+// bits returns the size of the serialized table in bits.
+func (lt *lengthTable) bits() int {
+	bits := clCountBits + lt.count*clLengthBits
+	for _, tok := range lt.tokens {
+		bits += int(lt.clLengths[tok.sym] + clExtraBits[tok.sym])
+	}
+	return bits
+}
+
+// write serializes the table to w.
+func (lt *lengthTable) write(w *bitio.Writer) error {
+	if err := w.WriteBits(uint64(lt.count-clMinCount), clCountBits); err != nil {
+		return fmt.Errorf("lengthTable.write: writing code-length count: %w", err)
+	}
+	for _, sym := range clOrder[:lt.count] {
+		if err := w.WriteBits(uint64(lt.clLengths[sym]), clLengthBits); err != nil {
+			return fmt.Errorf("lengthTable.write: writing code-length code: %w", err)
+		}
+	}
+	for _, tok := range lt.tokens {
+		code := lt.clCodes[tok.sym]
+		if err := w.WriteBits(code.c, code.bits); err != nil {
+			return fmt.Errorf("lengthTable.write: writing code length: %w", err)
+		}
+		if n := clExtraBits[tok.sym]; n > 0 {
+			if err := w.WriteBits(uint64(tok.extra), n); err != nil {
+				return fmt.Errorf("lengthTable.write: writing extra bits: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// readCodeLengths deserializes a table written by lengthTable.write.
+// Parameters:
+// - r: The bit reader positioned at the start of the table.
+// - n: The number of code lengths in the table.
+// Returns:
+// - The code lengths, checked with checkCodeLengths.
+// - An error wrapping ErrCorruptTable or ErrTruncatedStream if the table cannot be read.
+func readCodeLengths(r *bitReader, n int) ([]byte, error) {
+	countBits, err := r.ReadBits(clCountBits)
+	if err != nil {
+		return nil, fmt.Errorf("readCodeLengths: reading code-length count: %w", truncated(err))
+	}
+	count := int(countBits) + clMinCount
+	if count > clSymbols {
+		return nil, fmt.Errorf("readCodeLengths: %d code-length code lengths: %w", count, ErrCorruptTable)
+	}
+
+	clLengths := make([]byte, clSymbols)
+	for _, sym := range clOrder[:count] {
+		l, err := r.ReadBits(clLengthBits)
+		if err != nil {
+			return nil, fmt.Errorf("readCodeLengths: reading code-length code: %w", truncated(err))
+		}
+		clLengths[sym] = byte(l)
+	}
+	if err := checkCodeLengths(clLengths); err != nil {
+		return nil, fmt.Errorf("readCodeLengths: code-length code: %w", err)
+	}
+	clDecoder := newHuffmanDecoder(clLengths)
+	if len(clDecoder.tables) == 0 {
+		return nil, fmt.Errorf("readCodeLengths: empty code-length code: %w", ErrCorruptTable)
+	}
+
+	lengths := make([]byte, 0, n)
+	for len(lengths) < n {
+		sym, err := clDecoder.decode(r)
+		if err != nil {
+			return nil, fmt.Errorf("readCodeLengths: length %d: %w", len(lengths), truncated(err))
+		}
+		extra := uint64(0)
+		if bits := clExtraBits[sym]; bits > 0 {
+			if extra, err = r.ReadBits(bits); err != nil {
+				return nil, fmt.Errorf("readCodeLengths: reading extra bits: %w", truncated(err))
+			}
+		}
+
+		value, repeat := byte(sym), 1
+		switch sym {
+		case clRepeat:
+			if len(lengths) == 0 {
+				return nil, fmt.Errorf("readCodeLengths: repeat without a previous length: %w", ErrCorruptTable)
+			}
+			value, repeat = lengths[len(lengths)-1], int(extra)+3
+		case clZeros:
+			value, repeat = 0, int(extra)+3
+		case clZerosLong:
+			value, repeat = 0, int(extra)+11
+		case clLong:
+			value = byte(extra) + 16
+		}
+		if len(lengths)+repeat > n {
+			return nil, fmt.Errorf("readCodeLengths: run of %d lengths overflows %d symbols: %w", repeat, n, ErrCorruptTable)
+		}
+		for i := 0; i < repeat; i++ {
+			lengths = append(lengths, value)
+		}
+	}
+
+	if err := checkCodeLengths(lengths); err != nil {
+		return nil, fmt.Errorf("readCodeLengths: %w", err)
+	}
+	return lengths, nil
+}
@@ -0,0 +1,143 @@
+// canonical_test.go
+// Package lzhuff contains tests for canonical Huffman codes and the serialization of code lengths.
+// These tests verify the code assignment against RFC 1951 and that every table survives a round
+// trip through its compact serialized form.
+
+package lzhuff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/icza/bitio"
+)
+
+// Test_canonicalCodes tests the code assignment with the example of RFC 1951 section 3.2.2.
+func Test_canonicalCodes(t *testing.T) {
+	lengths := []byte{3, 3, 3, 3, 3, 2, 4, 4}
+	want := []Code{
+		{c: 0b010, bits: 3},
+		{c: 0b011, bits: 3},
+		{c: 0b100, bits: 3},
+		{c: 0b101, bits: 3},
+		{c: 0b110, bits: 3},
+		{c: 0b00, bits: 2},
+		{c: 0b1110, bits: 4},
+		{c: 0b1111, bits: 4},
+	}
+
+	got := canonicalCodes(lengths)
+	for sym := range want {
+		if got[sym] != want[sym] {
+			t.Errorf("canonicalCodes()[%d] = %d-bit %b; want %d-bit %b", sym, got[sym].bits, got[sym].c, want[sym].bits, want[sym].c)
+		}
+	}
+}
+
+// Test_lengthTableRoundTrip tests that code lengths are restored exactly after serialization,
+// including runs of every kind and lengths that need the clLong escape.
+func Test_lengthTableRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		lengths func() []byte
+	}{
+		{
+			name: "Empty",
+			lengths: func() []byte {
+				return make([]byte, 32)
+			},
+		},
+		{
+			name: "Single code",
+			lengths: func() []byte {
+				lengths := make([]byte, 256)
+				lengths[42] = 1
+				return lengths
+			},
+		},
+		{
+			name: "Uniform",
+			lengths: func() []byte {
+				return bytes.Repeat([]byte{8}, 256)
+			},
+		},
+		{
+			name: "Mixed runs",
+			lengths: func() []byte {
+				lengths := make([]byte, 256)
+				for sym := 100; sym < 108; sym++ {
+					lengths[sym] = 4
+				}
+				lengths[110], lengths[111], lengths[200] = 3, 3, 2
+				return lengths
+			},
+		},
+		{
+			name: "Long codes",
+			lengths: func() []byte {
+				// A skewed code with lengths 1, 2, ..., 39, 39.
+				lengths := make([]byte, 256)
+				for sym := 0; sym < 39; sym++ {
+					lengths[sym*5] = byte(sym + 1)
+				}
+				lengths[250] = 39
+				return lengths
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			lengths := tt.lengths()
+			if err := checkCodeLengths(lengths); err != nil {
+				t.Fatalf("checkCodeLengths() error = %v", err)
+			}
+
+			var buf bytes.Buffer
+			w := bitio.NewWriter(&buf)
+			lt := newLengthTable(lengths)
+			if err := lt.write(w); err != nil {
+				t.Fatalf("lengthTable.write() error = %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("bitio.Writer.Close() error = %v", err)
+			}
+			if want := (lt.bits() + 7) / 8; buf.Len() != want {
+				t.Errorf("serialized table is %d bytes; lengthTable.bits() promises %d", buf.Len(), want)
+			}
+
+			got, err := readCodeLengths(newBitReader(&buf), len(lengths))
+			if err != nil {
+				t.Fatalf("readCodeLengths() error = %v", err)
+			}
+			if !bytes.Equal(got, lengths) {
+				t.Errorf("readCodeLengths() = %v; want %v", got, lengths)
+			}
+		})
+	}
+}
+
+// Test_checkCodeLengths tests that unusable code lengths are rejected, while incomplete and empty
+// codes are accepted.
+func Test_checkCodeLengths(t *testing.T) {
+	tests := []struct {
+		name    string
+		lengths []byte
+		wantErr error
+	}{
+		{name: "No codes", lengths: []byte{0, 0, 0}, wantErr: nil},
+		{name: "Single code", lengths: []byte{0, 1, 0}, wantErr: nil},
+		{name: "Oversubscribed", lengths: []byte{1, 1, 1}, wantErr: ErrCorruptTable},
+		{name: "Too long", lengths: []byte{1, maxCodeBits + 1}, wantErr: ErrCorruptTable},
+	}
+
+	for _, tt := range tests {
+		if err := checkCodeLengths(tt.lengths); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: checkCodeLengths() error = %v; want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// context.go
+// Package lzhuff provides the literal contexts of the optional order-1 mode. In this mode the
+// literal/length symbols are coded with one code or model per class of the byte preceding them,
+// so that, in text, the letters likely after a letter no longer share their codes with the
+// letters likely after a space. The classes are coarse, which keeps the tables of a block few and
+// small while capturing most of the gain of conditioning on the whole previous byte.
+
+package lzhuff
+
+// literalContexts is the number of classes of the previous byte.
+const literalContexts = 4
+
+// Classes of the previous byte.
+const (
+	contextSpace  = iota // Whitespace, control bytes, and the start of the stream.
+	contextLetter        // ASCII letters.
+	contextDigit         // ASCII digits.
+	contextOther         // Punctuation and bytes above ASCII.
+)
+
+// contextClasses maps every byte to its class.
+var contextClasses = func() [256]byte {
+	var classes [256]byte
+	for c := range classes {
+		switch {
+		case c <= ' ' || c == 0x7f:
+			classes[c] = contextSpace
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			classes[c] = contextLetter
+		case c >= '0' && c <= '9':
+			classes[c] = contextDigit
+		default:
+			classes[c] = contextOther
+		}
+	}
+	return classes
+}()
+
+// windowContext returns the class of the last byte of window, the context of the next symbol.
+func windowContext(window []byte) int {
+	if len(window) == 0 {
+		return contextSpace
+	}
+	return int(contextClasses[window[len(window)-1]])
+}
+
+// valueContexts returns the context of every Value of a block and of the end-of-block marker.
+// Parameters:
+// - buf: The history followed by the bytes of the block.
+// - start: The position of the block in buf.
+// - values: The values of the block.
+// Returns:
+// - The context of every Value followed by the context of the end-of-block marker.
+func valueContexts(buf []byte, start int, values []Value) []byte {
+	contexts := make([]byte, len(values)+1)
+	pos := start
+	for i, v := range values {
+		contexts[i] = byte(windowContext(buf[:pos]))
+		if v.IsLiteral {
+			pos++
+		} else {
+			pos += int(v.length)
+		}
+	}
+	contexts[len(values)] = byte(windowContext(buf[:pos]))
+	return contexts
+}
+
+// contextCount returns the number of literal/length codes of a block with the given contexts.
+func contextCount(contexts []byte) int {
+	if contexts == nil {
+		return 1
+	}
+	return literalContexts
+}
+
+// contextOf returns the context of the i-th Value, or of the end-of-block marker for
+// i == len(values). Without contexts every Value has context 0.
+func contextOf(contexts []byte, i int) int {
+	if contexts == nil {
+		return 0
+	}
+	return int(contexts[i])
+}
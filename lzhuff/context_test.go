@@ -0,0 +1,59 @@
+// context_test.go
+// Package lzhuff contains tests for the literal contexts.
+// These tests verify that bytes fall into the expected classes and that every Value gets the class
+// of the byte before it, across literals, matches and the history preceding the block.
+
+package lzhuff
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test_valueContexts tests the context of every Value and of the end-of-block marker.
+func Test_valueContexts(t *testing.T) {
+	tests := []struct {
+		name   string
+		buf    string
+		start  int
+		values []Value
+		want   []byte
+	}{
+		{
+			name:   "Start of the stream",
+			buf:    "a1.",
+			values: BytesToValues([]byte("a1."), 4, 255, 4096),
+			want:   []byte{contextSpace, contextLetter, contextDigit, contextOther},
+		},
+		{
+			name:   "After history",
+			buf:    "x\n",
+			start:  1,
+			values: []Value{NewValue(true, '\n', 0, 0)},
+			want:   []byte{contextLetter, contextSpace},
+		},
+		{
+			name:   "After a match",
+			buf:    "ab ab ab9",
+			values: []Value{NewValue(true, 'a', 0, 0), NewValue(true, 'b', 0, 0), NewValue(true, ' ', 0, 0), NewValue(false, 0, 5, 3), NewValue(true, '9', 0, 0)},
+			want:   []byte{contextSpace, contextLetter, contextLetter, contextSpace, contextLetter, contextDigit},
+		},
+		{
+			name:   "Bytes above ASCII",
+			buf:    "\xc3\xa9",
+			values: []Value{NewValue(true, 0xc3, 0, 0), NewValue(true, 0xa9, 0, 0)},
+			want:   []byte{contextSpace, contextOther, contextOther},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			if got := valueContexts([]byte(tt.buf), tt.start, tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("valueContexts() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// decoder.go
+// Package lzhuff provides the table-driven Huffman decoder. Instead of reading a code bit by bit,
+// the decoder peeks at the next decodeTableBits bits and looks them up in a table that holds the
+// symbol and the length of every code they can start with. Codes longer than the table width are
+// resolved through secondary tables indexed by the bits that follow, so each table stays small
+// even for codes of up to maxCodeBits bits.
+
+package lzhuff
+
+import (
+	"fmt"
+	"sort"
+)
+
+// decodeTableBits is the number of bits that index a lookup table of huffmanDecoder.
+// Codes up to this length, which are most of the codes of a block, take a single lookup.
+const decodeTableBits = 10
+
+// decodeEntry is an entry of a lookup table of huffmanDecoder.
+// An entry with bits == 0 belongs to no code.
+type decodeEntry struct {
+	value uint16 // The symbol, or the index of the secondary table for a link.
+	bits  byte   // The number of bits of the code within this table, or the width of the secondary table.
+	link  bool   // Whether the entry refers to a secondary table.
+}
+
+// huffmanDecoder decodes the symbols of one alphabet.
+type huffmanDecoder struct {
+	tables []decodeTable // Lookup tables; the first one is indexed by the first bits of a code.
+}
+
+// decodeTable is a lookup table of huffmanDecoder.
+type decodeTable struct {
+	entries []decodeEntry // Entry of every value of the next width bits.
+	width   byte          // Number of bits indexing entries.
+}
+
+// symbolCode is a code together with its symbol, used while building the lookup tables.
+type symbolCode struct {
+	sym  int
+	code Code
+}
+
+// newHuffmanDecoder builds the decoder of the canonical code with the given code lengths.
+// The decoder of a code without symbols has no tables and decodes nothing.
+// Parameters:
+// - lengths: The code length of every symbol, zero for symbols without a code.
+func newHuffmanDecoder(lengths []byte) huffmanDecoder {
+	var codes []symbolCode
+	for sym, code := range canonicalCodes(lengths) {
+		if code.bits != 0 {
+			codes = append(codes, symbolCode{sym: sym, code: code})
+		}
+	}
+	var d huffmanDecoder
+	if len(codes) > 0 {
+		d.addTable(codes)
+	}
+	return d
+}
+
+// addTable builds the lookup table of codes and the secondary tables of the codes longer than
+// its width, and returns the index of the table.
+// Parameters:
+// - codes: The codes to decode, stripped of the bits that lead to this table.
+func (d *huffmanDecoder) addTable(codes []symbolCode) int {
+	var width byte
+	for _, sc := range codes {
+		if sc.code.bits > width {
+			width = sc.code.bits
+		}
+	}
+	if width > decodeTableBits {
+		width = decodeTableBits
+	}
+
+	index := len(d.tables)
+	entries := make([]decodeEntry, 1<<width)
+	d.tables = append(d.tables, decodeTable{entries: entries, width: width})
+
+	// Codes that fit into the table fill every entry they are a prefix of; longer codes are
+	// grouped by their first width bits.
+	long := make(map[uint64][]symbolCode)
+	for _, sc := range codes {
+		if sc.code.bits <= width {
+			shift := width - sc.code.bits
+			first := sc.code.c << shift
+			for i := first; i < first+1<<shift; i++ {
+				entries[i] = decodeEntry{value: uint16(sc.sym), bits: sc.code.bits}
+			}
+			continue
+		}
+		rest := sc.code.bits - width
+		prefix := sc.code.c >> rest
+		long[prefix] = append(long[prefix], symbolCode{sym: sc.sym, code: Code{c: sc.code.c & (1<<rest - 1), bits: rest}})
+	}
+
+	prefixes := make([]uint64, 0, len(long))
+	for prefix := range long {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i] < prefixes[j] })
+	for _, prefix := range prefixes {
+		sub := d.addTable(long[prefix])
+		entries[prefix] = decodeEntry{value: uint16(sub), bits: d.tables[sub].width, link: true}
+	}
+	return index
+}
+
+// decode reads the next symbol from r.
+// Returns:
+// - The decoded symbol.
+// - An error wrapping ErrUnknownCode if no code matches, or the error of r if the stream ends
+// within the code.
+func (d *huffmanDecoder) decode(r *bitReader) (int, error) {
+	if len(d.tables) == 0 {
+		return 0, fmt.Errorf("huffmanDecoder.decode: empty code: %w", ErrUnknownCode)
+	}
+	t := &d.tables[0]
+	for {
+		bits, avail := r.peek(t.width)
+		e := t.entries[bits]
+		switch {
+		case e.link && avail >= t.width:
+			r.consume(t.width)
+			t = &d.tables[e.value]
+		case !e.link && e.bits != 0 && avail >= e.bits:
+			r.consume(e.bits)
+			return int(e.value), nil
+		case avail < t.width:
+			// The stream ends before the bits that would complete or identify the code.
+			return 0, r.shortRead()
+		default:
+			return 0, fmt.Errorf("huffmanDecoder.decode: no code matches %d-bit prefix %b: %w", t.width, bits, ErrUnknownCode)
+		}
+	}
+}
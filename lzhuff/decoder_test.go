@@ -0,0 +1,236 @@
+// decoder_test.go
+// Package lzhuff contains tests for the table-driven Huffman decoder.
+// These tests compare it with a reference decoder that reads one bit at a time and looks the
+// code read so far up in a map, on short, long and incomplete codes and on truncated streams.
+
+package lzhuff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/icza/bitio"
+)
+
+// addBit appends a single bit to a Code struct, shifting existing bits to make room.
+// Parameters:
+// - c: The current Code struct.
+// - bit: The bit to append (true for 1, false for 0).
+// Returns:
+// - The updated Code struct with the new bit appended.
+func addBit(c Code, bit bool) Code {
+	var b uint64
+	if bit {
+		b = 1
+	}
+	return Code{
+		c:    (c.c << 1) | b,
+		bits: c.bits + 1,
+	}
+}
+
+// codeLookup builds the reverse mapping from codes to symbols used for decoding.
+// Returns:
+// - The symbol of every code.
+// - The length of the longest code, 0 for an empty code.
+func codeLookup(codes []Code) (map[Code]int, byte) {
+	table := make(map[Code]int)
+	var maxBits byte
+	for sym, code := range codes {
+		if code.bits == 0 {
+			continue
+		}
+		table[code] = sym
+		if code.bits > maxBits {
+			maxBits = code.bits
+		}
+	}
+	return table, maxBits
+}
+
+// decodeSymbol reads bits from r until they form a code of table.
+// Parameters:
+// - r: The bit reader to read from.
+// - table: The symbol of every code.
+// - maxBits: The length of the longest code in table.
+// Returns:
+// - The decoded symbol.
+// - An error wrapping ErrUnknownCode if no code matches, or the error of r.
+func decodeSymbol(r *bitReader, table map[Code]int, maxBits byte) (int, error) {
+	currentCode := Code{}
+
+	for currentCode.bits < maxBits {
+		// Read the next bit and append it to the current code.
+		bit, err := r.ReadBool()
+		if err != nil {
+			return 0, err
+		}
+		currentCode = addBit(currentCode, bit)
+
+		// Check if the current code exists in the table.
+		if val, exists := table[currentCode]; exists {
+			return val, nil
+		}
+	}
+	return 0, fmt.Errorf("decodeSymbol: no code matches %d-bit prefix %b: %w", currentCode.bits, currentCode.c, ErrUnknownCode)
+}
+
+// encodeSymbols writes the codes of syms and returns the stream, without padding bits.
+func encodeSymbols(t testing.TB, codes []Code, syms []int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := bitio.NewWriter(&buf)
+	for _, sym := range syms {
+		if err := w.WriteBits(codes[sym].c, codes[sym].bits); err != nil {
+			t.Fatalf("bitio.Writer.WriteBits() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("bitio.Writer.Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test_huffmanDecoder tests that the table-driven decoder returns the same symbols and errors as
+// the reference decoder.
+func Test_huffmanDecoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		lengths func() []byte
+	}{
+		{
+			name: "Single code",
+			lengths: func() []byte {
+				return []byte{0, 0, 1}
+			},
+		},
+		{
+			name: "Short codes",
+			lengths: func() []byte {
+				return []byte{3, 3, 3, 3, 3, 2, 4, 4}
+			},
+		},
+		{
+			name: "Literal/length alphabet",
+			lengths: func() []byte {
+				return constructHuffmanTrees(BytesToValues(testCorpus()["Words"], 4, 255, 4096), nil).codeTables(DefaultMaxCodeBits).litLen[0].lengths()
+			},
+		},
+		{
+			name: "Long codes",
+			lengths: func() []byte {
+				lengths := make([]byte, 64)
+				buildHuffmanTree(fibonacciFrequencies(64)).codeLengths(0, lengths)
+				return lengths
+			},
+		},
+		{
+			name: "Incomplete code",
+			lengths: func() []byte {
+				return []byte{1, 0, 3, 12, 12, 0, 20}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			lengths := tt.lengths()
+			codes := canonicalCodes(lengths)
+			var syms []int
+			for sym, code := range codes {
+				if code.bits != 0 {
+					syms = append(syms, sym)
+				}
+			}
+			rng := rand.New(rand.NewSource(15))
+			message := make([]int, 2000)
+			for i := range message {
+				message[i] = syms[rng.Intn(len(syms))]
+			}
+			stream := encodeSymbols(t, codes, message)
+			// Append bytes that match no code of an incomplete code, then cut the stream short.
+			stream = append(stream, 0xff, 0xff, 0xff)
+
+			d := newHuffmanDecoder(lengths)
+			table, maxBits := codeLookup(codes)
+			for _, cut := range []int{len(stream), len(stream) - 2, len(stream) / 2} {
+				r, ref := newBitReader(bytes.NewReader(stream[:cut])), newBitReader(bytes.NewReader(stream[:cut]))
+				for i := 0; ; i++ {
+					got, gotErr := d.decode(r)
+					want, wantErr := decodeSymbol(ref, table, maxBits)
+					if got != want || errKind(gotErr) != errKind(wantErr) {
+						t.Fatalf("stream of %d bytes, symbol %d: decode() = %d, %v; reference = %d, %v", cut, i, got, gotErr, want, wantErr)
+					}
+					if wantErr != nil {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// errKind reduces err to the sentinel error the decoders agree on.
+func errKind(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownCode):
+		return ErrUnknownCode
+	case errors.Is(truncated(err), ErrTruncatedStream):
+		return ErrTruncatedStream
+	}
+	return err
+}
+
+// Test_huffmanDecoderEmpty tests that a decoder without codes rejects every stream.
+func Test_huffmanDecoderEmpty(t *testing.T) {
+	d := newHuffmanDecoder(make([]byte, 16))
+	if _, err := d.decode(newBitReader(bytes.NewReader([]byte{0}))); !errors.Is(err, ErrUnknownCode) {
+		t.Errorf("decode() error = %v; want %v", err, ErrUnknownCode)
+	}
+}
+
+// Benchmark_huffmanDecoder benchmarks the table-driven decoder against the reference decoder on
+// the literal/length code of a text corpus.
+func Benchmark_huffmanDecoder(b *testing.B) {
+	input := testCorpus()["Words"]
+	values := BytesToValues(input, 4, 255, 4096)
+	codes := constructHuffmanTrees(values, nil).codeTables(DefaultMaxCodeBits).litLen[0]
+	message := make([]int, len(input))
+	for i, c := range input {
+		message[i] = int(c)
+	}
+	stream := encodeSymbols(b, codes, message)
+	lengths := codes.lengths()
+
+	b.Run("Table", func(b *testing.B) {
+		d := newHuffmanDecoder(lengths)
+		b.SetBytes(int64(len(message)))
+		for n := 0; n < b.N; n++ {
+			r := newBitReader(bytes.NewReader(stream))
+			for range message {
+				if _, err := d.decode(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("Reference", func(b *testing.B) {
+		table, maxBits := codeLookup(canonicalCodes(lengths))
+		b.SetBytes(int64(len(message)))
+		for n := 0; n < b.N; n++ {
+			r := newBitReader(bytes.NewReader(stream))
+			for range message {
+				if _, err := decodeSymbol(r, table, maxBits); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,275 @@
+// deflate.go
+// Package lzhuff provides DeflateWriter, which writes the parse of the LZ77 stage as a raw DEFLATE
+// stream (RFC 1951) that any inflate implementation, such as compress/flate, zlib or gunzip, can
+// decode. Every block of input becomes one DEFLATE block: stored, coded with the fixed Huffman
+// codes of the format, or coded with dynamic Huffman codes fitted to the block, whichever is
+// smallest. DEFLATE limits matches to 3 to 258 bytes and distances to 32 KiB, so the settings of
+// the LZ77 stage are clamped to these limits.
+
+package lzhuff
+
+// Limits of the DEFLATE format.
+const (
+	deflateMinMatch    = 3         // Shortest match a pointer can describe.
+	deflateMaxMatch    = 258       // Longest match a pointer can describe.
+	deflateWindow      = 1 << 15   // Largest distance of a pointer.
+	deflateMaxCodeBits = 15        // Longest literal/length or distance code.
+	deflateMaxCLBits   = 7         // Longest code of the code-length code.
+	deflateMaxStored   = 1<<16 - 1 // Longest stored block.
+)
+
+// Block types of the DEFLATE format, stored in the BTYPE field of the block header.
+const (
+	deflateStored  = 0 // The block holds its bytes uncompressed.
+	deflateFixed   = 1 // The block is coded with the fixed Huffman codes.
+	deflateDynamic = 2 // The block is coded with Huffman codes stored in the block.
+)
+
+// Alphabets of the DEFLATE format. Literals, the end-of-block marker and match lengths share one
+// alphabet, like in the format of this package; the distance alphabet is distanceCode limited to
+// distances up to deflateWindow, whose 30 symbols are those of DEFLATE.
+const (
+	deflateEOB          = 256 // Symbol of the end-of-block marker.
+	deflateMaxLengthSym = 285 // Symbol of a match of deflateMaxMatch bytes, which has no extra bits.
+	deflateLitLenSyms   = 286 // Size of the literal/length alphabet.
+	deflateDistanceSyms = 30  // Size of the distance alphabet.
+	deflateCLSyms       = 19  // Size of the code-length alphabet.
+)
+
+// deflateLengthCode codes match lengths 3 to 257 as the symbols following deflateEOB.
+var deflateLengthCode = newExtraCode(deflateMinMatch, deflateMaxMatch-1, 2)
+
+// deflateCodes holds the codes a DEFLATE block is coded with.
+type deflateCodes struct {
+	litLen    CodeTable // Codes of the literal/length alphabet.
+	distances CodeTable // Codes of the distance alphabet.
+}
+
+// deflateFixedCodes are the fixed Huffman codes of RFC 1951 section 3.2.6.
+var deflateFixedCodes = func() deflateCodes {
+	litLen := make([]byte, 288)
+	for sym := range litLen {
+		switch {
+		case sym < 144:
+			litLen[sym] = 8
+		case sym < 256:
+			litLen[sym] = 9
+		case sym < 280:
+			litLen[sym] = 7
+		default:
+			litLen[sym] = 8
+		}
+	}
+	distances := make([]byte, 32)
+	for sym := range distances {
+		distances[sym] = 5
+	}
+	return deflateCodes{litLen: canonicalCodes(litLen), distances: canonicalCodes(distances)}
+}()
+
+// deflateLengthSymbol returns the symbol of the literal/length alphabet for a match of length
+// bytes, and its extra bits.
+func deflateLengthSymbol(length int) (int, uint64, byte) {
+	if length == deflateMaxMatch {
+		return deflateMaxLengthSym, 0, 0
+	}
+	sym, extra, extraBits := deflateLengthCode.encode(length)
+	return deflateEOB + 1 + sym, extra, extraBits
+}
+
+// deflateFrequencies counts the occurrences of every literal/length and distance symbol in values,
+// including the end-of-block marker.
+func deflateFrequencies(values []Value) ([]int, []int) {
+	litLen := make([]int, deflateLitLenSyms)
+	distances := make([]int, deflateDistanceSyms)
+	for _, v := range values {
+		if v.IsLiteral {
+			litLen[v.val]++
+			continue
+		}
+		sym, _, _ := deflateLengthSymbol(int(v.length))
+		litLen[sym]++
+		sym, _, _ = distanceCode.encode(int(v.distance))
+		distances[sym]++
+	}
+	litLen[deflateEOB]++
+	return litLen, distances
+}
+
+// dataBits returns the number of bits values and the end-of-block marker are coded in with c.
+func (c deflateCodes) dataBits(values []Value) int {
+	n := int(c.litLen[deflateEOB].bits)
+	for _, v := range values {
+		if v.IsLiteral {
+			n += int(c.litLen[v.val].bits)
+			continue
+		}
+		sym, _, extraBits := deflateLengthSymbol(int(v.length))
+		n += int(c.litLen[sym].bits + extraBits)
+		sym, _, extraBits = distanceCode.encode(int(v.distance))
+		n += int(c.distances[sym].bits + extraBits)
+	}
+	return n
+}
+
+// writeData writes values followed by the end-of-block marker coded with c.
+func (c deflateCodes) writeData(w *lsbWriter, values []Value) {
+	for _, v := range values {
+		if v.IsLiteral {
+			w.writeCode(c.litLen[v.val])
+			continue
+		}
+		sym, extra, extraBits := deflateLengthSymbol(int(v.length))
+		w.writeCode(c.litLen[sym])
+		w.writeBits(extra, extraBits)
+		sym, extra, extraBits = distanceCode.encode(int(v.distance))
+		w.writeCode(c.distances[sym])
+		w.writeBits(extra, extraBits)
+	}
+	w.writeCode(c.litLen[deflateEOB])
+}
+
+// deflateTable is the header of a dynamic block: the code lengths of both alphabets, run-length
+// encoded with the code-length alphabet this package shares with DEFLATE.
+type deflateTable struct {
+	codes     deflateCodes        // Codes described by the table.
+	nLitLen   int                 // Number of literal/length code lengths stored (HLIT + 257).
+	nDistance int                 // Number of distance code lengths stored (HDIST + 1).
+	tokens    []clToken           // Run-length encoded code lengths of both alphabets.
+	clLengths [deflateCLSyms]byte // Code lengths of the code-length code.
+	clCodes   []Code              // Canonical code-length code.
+	nCL       int                 // Number of code-length code lengths stored, in clOrder (HCLEN + 4).
+}
+
+// newDeflateTable builds the dynamic codes of a block from its symbol frequencies.
+// Parameters:
+// - litLenFreqs, distanceFreqs: The frequencies returned by deflateFrequencies.
+// - maxBits: The length of the longest code allowed, at most deflateMaxCodeBits.
+func newDeflateTable(litLenFreqs, distanceFreqs []int, maxBits int) *deflateTable {
+	// A block without pointers still describes one distance code, which some decoders require.
+	if !hasOccurrences(distanceFreqs) {
+		distanceFreqs = append([]int{1}, distanceFreqs[1:]...)
+	}
+	t := &deflateTable{codes: deflateCodes{
+		litLen:    createCodeTable(buildHuffmanTree(litLenFreqs), deflateLitLenSyms, maxBits),
+		distances: createCodeTable(buildHuffmanTree(distanceFreqs), deflateDistanceSyms, maxBits),
+	}}
+
+	litLen, distances := t.codes.litLen.lengths(), t.codes.distances.lengths()
+	t.nLitLen = trimmedLength(litLen, deflateEOB+1)
+	t.nDistance = trimmedLength(distances, 1)
+	// The two lists are run-length encoded as one, so runs may cross from one into the other.
+	t.tokens = encodeCodeLengths(append(litLen[:t.nLitLen:t.nLitLen], distances[:t.nDistance]...))
+
+	freqs := make([]int, deflateCLSyms)
+	for _, tok := range t.tokens {
+		freqs[tok.sym]++
+	}
+	buildHuffmanTree(freqs).limitedCodeLengths(t.clLengths[:], deflateMaxCLBits)
+	t.clCodes = canonicalCodes(t.clLengths[:])
+	t.nCL = trimmedLength(reorder(t.clLengths[:], clOrder[:deflateCLSyms]), clMinCount)
+	return t
+}
+
+// hasOccurrences reports whether any frequency of freqs is positive.
+func hasOccurrences(freqs []int) bool {
+	for _, f := range freqs {
+		if f > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// trimmedLength returns the length of lengths without its trailing zeros, but at least minLen.
+func trimmedLength(lengths []byte, minLen int) int {
+	n := len(lengths)
+	for n > minLen && lengths[n-1] == 0 {
+		n--
+	}
+	return n
+}
+
+// reorder returns the elements of s in the given order.
+func reorder(s []byte, order []byte) []byte {
+	r := make([]byte, len(order))
+	for i, j := range order {
+		r[i] = s[j]
+	}
+	return r
+}
+
+// bits returns the size of the table in bits, without the block header.
+func (t *deflateTable) bits() int {
+	n := 5 + 5 + 4 + 3*t.nCL
+	for _, tok := range t.tokens {
+		n += int(t.clLengths[tok.sym] + clExtraBits[tok.sym])
+	}
+	return n
+}
+
+// write writes the table following the header of a dynamic block.
+func (t *deflateTable) write(w *lsbWriter) {
+	w.writeBits(uint64(t.nLitLen-(deflateEOB+1)), 5)
+	w.writeBits(uint64(t.nDistance-1), 5)
+	w.writeBits(uint64(t.nCL-clMinCount), 4)
+	for _, sym := range clOrder[:t.nCL] {
+		w.writeBits(uint64(t.clLengths[sym]), 3)
+	}
+	for _, tok := range t.tokens {
+		w.writeCode(t.clCodes[tok.sym])
+		w.writeBits(uint64(tok.extra), clExtraBits[tok.sym])
+	}
+}
+
+// storedBits returns the size in bits of data written as stored blocks, starting at a stream
+// position whose bit offset within its byte is offset.
+func storedBits(data []byte, offset byte) int {
+	blocks := max(1, (len(data)+deflateMaxStored-1)/deflateMaxStored)
+	// Every stored block is padded to a byte boundary after its 3-bit header; all but the first
+	// start on a boundary.
+	pad := (8 - (int(offset)+3)%8) % 8
+	return pad + 5*(blocks-1) + blocks*(3+32) + 8*len(data)
+}
+
+// writeDeflateBlock writes the input of a block as the cheapest kind of DEFLATE block.
+// Parameters:
+// - w: The bit writer of the stream.
+// - values: The values of the block.
+// - data: The uncompressed bytes of the block, written as is when a stored block is smallest.
+// - last: Whether this is the final block of the stream.
+// - maxBits: The length of the longest dynamic code allowed.
+func writeDeflateBlock(w *lsbWriter, values []Value, data []byte, last bool, maxBits int) {
+	litLenFreqs, distanceFreqs := deflateFrequencies(values)
+	table := newDeflateTable(litLenFreqs, distanceFreqs, maxBits)
+	dynamicBits := table.bits() + table.codes.dataBits(values)
+	fixedBits := deflateFixedCodes.dataBits(values)
+
+	final := uint64(0)
+	if last {
+		final = 1
+	}
+	switch {
+	case storedBits(data, w.n) <= 3+min(fixedBits, dynamicBits):
+		for first := true; first || len(data) > 0; first = false {
+			n := min(len(data), deflateMaxStored)
+			if n < len(data) {
+				w.writeBits(deflateStored<<1, 3)
+			} else {
+				w.writeBits(final|deflateStored<<1, 3)
+			}
+			w.align()
+			w.writeBits(uint64(n), 16)
+			w.writeBits(uint64(^n&deflateMaxStored), 16)
+			w.writeBytes(data[:n])
+			data = data[n:]
+		}
+	case fixedBits <= dynamicBits:
+		w.writeBits(final|deflateFixed<<1, 3)
+		deflateFixedCodes.writeData(w, values)
+	default:
+		w.writeBits(final|deflateDynamic<<1, 3)
+		table.write(w)
+		table.codes.writeData(w, values)
+	}
+}
@@ -0,0 +1,145 @@
+// deflate_test.go
+// Package lzhuff contains tests for the DEFLATE encoder.
+// These tests verify that the streams written by DeflateWriter decode with compress/flate under
+// every kind of settings, including settings beyond the limits of DEFLATE, and that every block
+// is written as the cheapest of the three block types.
+
+package lzhuff
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// deflate compresses input with a DeflateWriter configured by opts.
+func deflate(t *testing.T, input []byte, opts ...Option) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	zw, err := NewDeflateWriter(&compressed, opts...)
+	if err != nil {
+		t.Fatalf("NewDeflateWriter() error = %v", err)
+	}
+	if _, err := zw.Write(input); err != nil {
+		t.Fatalf("DeflateWriter.Write() error = %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("DeflateWriter.Close() error = %v", err)
+	}
+	return compressed.Bytes()
+}
+
+// Test_DeflateWriter tests that compress/flate restores the input from the output of DeflateWriter.
+func Test_DeflateWriter(t *testing.T) {
+	rng := rand.New(rand.NewSource(22))
+	largeRandom := make([]byte, 150000)
+	rng.Read(largeRandom)
+	corpus := testCorpus()
+	corpus["Empty"] = nil
+	corpus["Single byte"] = []byte{'a'}
+	corpus["Large random"] = largeRandom
+	corpus["Long runs"] = bytes.Repeat(append(bytes.Repeat([]byte{'A'}, 1000), bytes.Repeat([]byte{'B'}, 600)...), 40)
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Defaults"},
+		{name: "Fastest level", opts: []Option{WithLevel(MinLevel)}},
+		{name: "Optimal parse", opts: []Option{WithLevel(MaxLevel)}},
+		{name: "Small blocks", opts: []Option{WithBlockSize(1000)}},
+		{name: "Large blocks", opts: []Option{WithBlockSize(1 << 18)}},
+		{name: "No matches", opts: []Option{WithSearchSize(0)}},
+		{name: "Short codes", opts: []Option{WithMaxCodeBits(minCodeBits)}},
+		{name: "Beyond DEFLATE limits", opts: []Option{WithMinMatch(1), WithMaxMatch(MaxMatchLength), WithSearchSize(MaxSearchSize)}},
+		{name: "Long minimum match", opts: []Option{WithMinMatch(300), WithMaxMatch(400)}},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			for name, input := range corpus {
+				compressed := deflate(t, input, tt.opts...)
+				got, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+				if err != nil {
+					t.Fatalf("%s: flate reader error = %v", name, err)
+				}
+				if !bytes.Equal(got, input) {
+					t.Errorf("%s: flate reader does not restore the input", name)
+				}
+			}
+		})
+	}
+}
+
+// Test_DeflateWriterMatchLimits tests that matches reach the 258 bytes of DEFLATE by default and
+// that the settings of the options are clamped to the limits of DEFLATE.
+func Test_DeflateWriterMatchLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantMinMatch int
+		wantMaxMatch int
+		wantWindow   int
+	}{
+		{name: "Defaults", wantMinMatch: DefaultMinMatch, wantMaxMatch: deflateMaxMatch, wantWindow: deflateWindow},
+		{name: "Shorter maximum", opts: []Option{WithMaxMatch(100)}, wantMinMatch: DefaultMinMatch, wantMaxMatch: 100, wantWindow: deflateWindow},
+		{name: "Default maximum of the package", opts: []Option{WithMaxMatch(DefaultMaxMatch)}, wantMinMatch: DefaultMinMatch, wantMaxMatch: DefaultMaxMatch, wantWindow: deflateWindow},
+		{name: "Beyond DEFLATE limits", opts: []Option{WithMinMatch(1), WithMaxMatch(MaxMatchLength)}, wantMinMatch: deflateMinMatch, wantMaxMatch: deflateMaxMatch, wantWindow: deflateWindow},
+		{name: "Small window", opts: []Option{WithSearchSize(1000)}, wantMinMatch: DefaultMinMatch, wantMaxMatch: deflateMaxMatch, wantWindow: 1000},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			zw, err := NewDeflateWriter(io.Discard, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewDeflateWriter() error = %v", err)
+			}
+			if p := zw.params; p.minMatch != tt.wantMinMatch || p.maxMatch != tt.wantMaxMatch || p.searchSize != tt.wantWindow {
+				t.Errorf("matches of %d to %d bytes within %d bytes; want %d to %d within %d",
+					p.minMatch, p.maxMatch, p.searchSize, tt.wantMinMatch, tt.wantMaxMatch, tt.wantWindow)
+			}
+		})
+	}
+}
+
+// Test_deflateBlockTypes tests that a block is stored, coded with the fixed codes or coded with
+// dynamic codes depending on which is smallest.
+func Test_deflateBlockTypes(t *testing.T) {
+	corpus := testCorpus()
+
+	tests := []struct {
+		name     string
+		input    []byte
+		wantType byte
+	}{
+		{name: "Incompressible", input: corpus["Random bytes"], wantType: deflateStored},
+		{name: "Short text", input: []byte("hello, hello"), wantType: deflateFixed},
+		{name: "Text", input: corpus["Words"], wantType: deflateDynamic},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			compressed := deflate(t, tt.input)
+			if final := compressed[0] & 1; final != 1 {
+				t.Errorf("BFINAL = %d; want 1", final)
+			}
+			if got := compressed[0] >> 1 & 3; got != tt.wantType {
+				t.Errorf("BTYPE = %d; want %d", got, tt.wantType)
+			}
+			if tt.wantType == deflateStored && len(compressed) != len(tt.input)+5 {
+				t.Errorf("stored stream is %d bytes; want %d", len(compressed), len(tt.input)+5)
+			}
+		})
+	}
+}
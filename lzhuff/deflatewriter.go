@@ -0,0 +1,116 @@
+// deflatewriter.go
+// Package lzhuff provides the DeflateWriter type, which compresses the data written to it into a
+// raw DEFLATE stream (RFC 1951) instead of the format of this package. It shares the options, the
+// block buffering and the LZ77 stage of Writer; only the entropy coding differs.
+
+package lzhuff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DeflateWriter is an io.WriteCloser that compresses the data written to it into a raw DEFLATE
+// stream, without the gzip or zlib framing. Data is compressed one block at a time; Close
+// compresses the final block.
+type DeflateWriter struct {
+	w      io.Writer  // Destination of the compressed stream.
+	cfg    config     // Settings applied by the options passed to NewDeflateWriter.
+	params lzParams   // Settings of the LZ77 stage, clamped to the limits of DEFLATE.
+	in     blockInput // Sliding window: history followed by the input not compressed yet.
+	bits   lsbWriter  // Compressed bits not written to w yet.
+	size   uint64     // Number of uncompressed bytes compressed so far.
+	closed bool       // Whether Close has already been called.
+	err    error      // First error encountered, returned by every later call.
+}
+
+// NewDeflateWriter returns a new DeflateWriter compressing data to w.
+// It accepts the options of NewWriter. The coder and the literal contexts have no effect, as
+// DEFLATE always uses Huffman codes, and the LZ77 settings are clamped to the limits of DEFLATE:
+// matches of 3 to 258 bytes, a window of at most 32 KiB and codes of at most 15 bits. Without
+// WithMaxMatch, matches reach 258 bytes rather than DefaultMaxMatch.
+// Parameters:
+// - w: The io.Writer that receives the compressed stream.
+// - opts: Options overriding the default compression settings.
+func NewDeflateWriter(w io.Writer, opts ...Option) (*DeflateWriter, error) {
+	// Matches may reach the longest length of DEFLATE unless WithMaxMatch sets a limit.
+	base := defaultConfig()
+	base.maxMatch = deflateMaxMatch
+	cfg, err := newConfig(base, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DeflateWriter{w: w, cfg: cfg, params: cfg.deflateParams(), in: blockInput{blockSize: cfg.blockSize}}, nil
+}
+
+// deflateParams returns the settings of the LZ77 stage described by c, clamped to the limits of
+// DEFLATE.
+func (c *config) deflateParams() lzParams {
+	p := c.lzParams()
+	p.minMatch = min(max(p.minMatch, deflateMinMatch), deflateMaxMatch)
+	p.maxMatch = min(max(p.maxMatch, p.minMatch), deflateMaxMatch)
+	p.searchSize = min(p.searchSize, deflateWindow)
+	return p
+}
+
+// Write collects p for compression, compressing a block every time a full block of input is
+// pending. It implements io.Writer.
+func (z *DeflateWriter) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errors.New("lzhuff: write to closed DeflateWriter")
+	}
+	written, err := z.in.write(p, func(n int) error { return z.writeBlock(n, false) })
+	z.err = err
+	return written, err
+}
+
+// Close compresses the remaining input as the final block and pads the stream to a whole byte.
+// It does not close the underlying io.Writer.
+func (z *DeflateWriter) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+
+	if z.err = z.writeBlock(z.in.pending(), true); z.err != nil {
+		return z.err
+	}
+	z.cfg.logf("Input size (bytes): %d\n", z.size)
+	if z.cfg.contentSize >= 0 && uint64(z.cfg.contentSize) != z.size {
+		z.err = fmt.Errorf("DeflateWriter.Close: wrote %d bytes, content size is %d: %w", z.size, z.cfg.contentSize, ErrSizeMismatch)
+	}
+	return z.err
+}
+
+// writeBlock compresses the next n pending bytes as one DEFLATE block, then slides the window so
+// that only the last 32 KiB of history are kept.
+// Parameters:
+// - n: The number of pending bytes to compress.
+// - last: Whether this is the final block of the stream.
+func (z *DeflateWriter) writeBlock(n int, last bool) error {
+	buf, start := z.in.buf[:z.in.history+n], z.in.history
+	// LZ coding, with pointers allowed into the history kept in the window.
+	values := parseValues(buf, start, z.params)
+	if err := z.cfg.traceValues(values); err != nil {
+		return err
+	}
+
+	writeDeflateBlock(&z.bits, values, buf[start:], last, min(z.cfg.maxCodeBits, deflateMaxCodeBits))
+	if last {
+		z.bits.align()
+	}
+	if err := z.bits.flush(z.w); err != nil {
+		return fmt.Errorf("DeflateWriter.writeBlock: %w", err)
+	}
+	z.size += uint64(n)
+
+	z.in.slide(len(buf), z.params.searchSize)
+	return nil
+}
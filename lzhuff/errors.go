@@ -0,0 +1,44 @@
+// errors.go
+// Package lzhuff defines the sentinel errors returned by the compression pipeline.
+// Errors returned by the package wrap one of these values so callers can test for
+// them with errors.Is.
+
+package lzhuff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrInvalidHeader is returned when a stream does not start with the expected magic bytes.
+	ErrInvalidHeader = errors.New("lzhuff: invalid header")
+	// ErrUnsupportedVersion is returned when a stream uses a format version or flags this package does not understand.
+	ErrUnsupportedVersion = errors.New("lzhuff: unsupported format version")
+	// ErrCorruptTable is returned when a serialized code table is malformed.
+	ErrCorruptTable = errors.New("lzhuff: corrupt code table")
+	// ErrTruncatedStream is returned when the compressed stream ends unexpectedly.
+	ErrTruncatedStream = errors.New("lzhuff: truncated stream")
+	// ErrUnknownCode is returned when the stream contains a code that is not in the code table.
+	ErrUnknownCode = errors.New("lzhuff: unknown code")
+	// ErrCorruptStream is returned when the framing of the compressed stream is malformed.
+	ErrCorruptStream = errors.New("lzhuff: corrupt stream")
+	// ErrInvalidDistance is returned when a pointer refers to data before the start of the output.
+	ErrInvalidDistance = errors.New("lzhuff: invalid pointer distance")
+	// ErrSizeMismatch is returned when the decoded data does not have the length recorded in the stream.
+	ErrSizeMismatch = errors.New("lzhuff: decoded size does not match stream")
+	// ErrChecksum is returned when a checksum stored in the stream does not match the data.
+	ErrChecksum = errors.New("lzhuff: checksum mismatch")
+)
+
+// truncated converts an end-of-input error into ErrTruncatedStream, keeping the original
+// error in the chain. Other errors are returned unchanged.
+// Parameters:
+// - err: The error returned by the underlying reader.
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrTruncatedStream, err)
+	}
+	return err
+}
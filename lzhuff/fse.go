@@ -0,0 +1,273 @@
+// fse.go
+// Package lzhuff provides the table-based asymmetric numeral system (tANS) coder in the style of
+// Finite State Entropy, the entropy coder selected with CoderFSE. The frequencies of an alphabet
+// are normalized to a power-of-two total and spread over a table whose every slot is a coder
+// state. Coding a symbol moves from one state to the next and reads or writes a few bits, so the
+// coder spends fractional bits per symbol like an arithmetic coder while decoding with a single
+// table lookup per symbol like a Huffman decoder.
+
+package lzhuff
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/icza/bitio"
+)
+
+// Limits of the size of a tANS table, as base-2 logarithms.
+const (
+	fseMinTableLog  = 5  // Smallest table; it keeps the spread step coprime with the table size.
+	fseMaxTableLog  = 11 // Largest table; 2048 states give a precision close to the entropy.
+	fseTableLogBits = 4  // Number of bits of the serialized table log.
+)
+
+// fseDecodeEntry is a state of the decoding table of an fseTable.
+type fseDecodeEntry struct {
+	sym    uint16 // The symbol decoded in this state.
+	nbBits byte   // The number of bits read to move to the next state.
+	base   uint32 // The next state before the bits read are added.
+}
+
+// fseTable is the tANS code of one alphabet.
+// An fseTable without symbols has an empty decoding table and codes nothing.
+type fseTable struct {
+	tableLog byte             // Base-2 logarithm of the number of states.
+	norm     []int            // Normalized frequency of every symbol; they sum to 1<<tableLog.
+	decode   []fseDecodeEntry // Decoding table indexed by state.
+	encode   [][]uint32       // The k-th state of every symbol, offset by the table size.
+}
+
+// newFSETable builds the tANS code of an alphabet with the given symbol frequencies.
+func newFSETable(freqs []int) *fseTable {
+	norm, tableLog := normalizeFrequencies(freqs)
+	return buildFSETable(norm, tableLog)
+}
+
+// normalizeFrequencies scales freqs to a power-of-two total, keeping every symbol that occurs.
+// The table log grows with the total, so short blocks get small tables that are cheap to store.
+// Returns:
+// - The normalized frequency of every symbol, all zero if no symbol occurs.
+// - The base-2 logarithm of their sum.
+func normalizeFrequencies(freqs []int) ([]int, byte) {
+	total, present := 0, 0
+	for _, f := range freqs {
+		total += f
+		if f > 0 {
+			present++
+		}
+	}
+	norm := make([]int, len(freqs))
+	if present == 0 {
+		return norm, fseMinTableLog
+	}
+
+	tableLog := max(min(bits.Len(uint(total-1)), fseMaxTableLog), fseMinTableLog)
+	tableLog = max(tableLog, bits.Len(uint(present-1)))
+	size := 1 << tableLog
+
+	// Round every frequency to the nearest share of the table, but keep at least one state for
+	// every symbol that occurs.
+	sum := 0
+	for sym, f := range freqs {
+		if f == 0 {
+			continue
+		}
+		norm[sym] = max(int((int64(f)*int64(size)*2+int64(total))/(int64(total)*2)), 1)
+		sum += norm[sym]
+	}
+	// Settle the rounding error on the most frequent symbols, which it affects the least.
+	for sum != size {
+		largest := 0
+		for sym := range norm {
+			if norm[sym] > norm[largest] {
+				largest = sym
+			}
+		}
+		if sum < size {
+			norm[largest] += size - sum
+			sum = size
+			continue
+		}
+		norm[largest]--
+		sum--
+	}
+	return norm, byte(tableLog)
+}
+
+// buildFSETable spreads the normalized frequencies over the states and builds the decoding and
+// encoding tables.
+// Parameters:
+// - norm: The normalized frequency of every symbol, summing to 1<<tableLog or to 0.
+// - tableLog: The base-2 logarithm of the number of states.
+func buildFSETable(norm []int, tableLog byte) *fseTable {
+	t := &fseTable{tableLog: tableLog, norm: norm, encode: make([][]uint32, len(norm))}
+	sum := 0
+	for _, n := range norm {
+		sum += n
+	}
+	if sum == 0 {
+		return t
+	}
+
+	// Spread the symbols with an odd step, which visits every state once and interleaves the
+	// states of every symbol across the table.
+	size := 1 << tableLog
+	step := size>>1 + size>>3 + 3
+	symbols := make([]uint16, size)
+	pos := 0
+	for sym, n := range norm {
+		for i := 0; i < n; i++ {
+			symbols[pos] = uint16(sym)
+			pos = (pos + step) & (size - 1)
+		}
+	}
+
+	// The k-th state of a symbol with normalized frequency n moves to state n+k, scaled back
+	// into the table by the bits read.
+	t.decode = make([]fseDecodeEntry, size)
+	next := make([]int, len(norm))
+	copy(next, norm)
+	for state, sym := range symbols {
+		x := next[sym]
+		next[sym]++
+		nbBits := int(tableLog) + 1 - bits.Len(uint(x))
+		t.decode[state] = fseDecodeEntry{sym: sym, nbBits: byte(nbBits), base: uint32(x<<nbBits - size)}
+		t.encode[sym] = append(t.encode[sym], uint32(size+state))
+	}
+	return t
+}
+
+// empty reports whether the table has no symbols.
+func (t *fseTable) empty() bool {
+	return len(t.decode) == 0
+}
+
+// initialState returns the state the encoder starts from, offset by the table size.
+func (t *fseTable) initialState() uint32 {
+	return 1 << t.tableLog
+}
+
+// encodeSymbol moves the encoder state of t, offset by the table size, to the state preceding
+// sym. Encoding runs backwards, so the state is the one the decoder reaches after sym.
+// Returns:
+// - The new state.
+// - The low bits of the old state the decoder reads after decoding sym, and their number.
+func (t *fseTable) encodeSymbol(state uint32, sym int) (uint32, uint64, byte) {
+	n := uint32(t.norm[sym])
+	nbBits := bits.Len32(state) - bits.Len32(n)
+	if state>>nbBits < n {
+		nbBits--
+	}
+	low := uint64(state) & (1<<nbBits - 1)
+	return t.encode[sym][state>>nbBits-n], low, byte(nbBits)
+}
+
+// write serializes the table log and the normalized frequencies to w. Every frequency is written
+// as an Elias gamma code of the frequency plus one, and a zero frequency is followed by the gamma
+// code of the number of further zeros plus one.
+func (t *fseTable) write(w *bitio.Writer) error {
+	if err := w.WriteBits(uint64(t.tableLog-fseMinTableLog), fseTableLogBits); err != nil {
+		return fmt.Errorf("fseTable.write: %w", err)
+	}
+	for sym := 0; sym < len(t.norm); sym++ {
+		if err := writeGamma(w, uint64(t.norm[sym])+1); err != nil {
+			return fmt.Errorf("fseTable.write: %w", err)
+		}
+		if t.norm[sym] != 0 {
+			continue
+		}
+		run := 0
+		for sym+1 < len(t.norm) && t.norm[sym+1] == 0 {
+			run++
+			sym++
+		}
+		if err := writeGamma(w, uint64(run)+1); err != nil {
+			return fmt.Errorf("fseTable.write: %w", err)
+		}
+	}
+	return nil
+}
+
+// readFSETable deserializes a table written by fseTable.write.
+// Parameters:
+// - r: The bit reader to read from.
+// - symbols: The number of symbols of the alphabet.
+// Returns:
+// - The table.
+// - An error wrapping ErrCorruptTable if the frequencies do not sum to the table size, or
+// ErrTruncatedStream if r ends early.
+func readFSETable(r *bitReader, symbols int) (*fseTable, error) {
+	logBits, err := r.ReadBits(fseTableLogBits)
+	if err != nil {
+		return nil, fmt.Errorf("readFSETable: %w", truncated(err))
+	}
+	tableLog := int(logBits) + fseMinTableLog
+	if tableLog > fseMaxTableLog {
+		return nil, fmt.Errorf("readFSETable: table log %d: %w", tableLog, ErrCorruptTable)
+	}
+
+	norm := make([]int, symbols)
+	sum := 0
+	for sym := 0; sym < symbols; sym++ {
+		v, err := readGamma(r)
+		if err != nil {
+			return nil, fmt.Errorf("readFSETable: %w", err)
+		}
+		norm[sym] = int(v - 1)
+		sum += norm[sym]
+		if sum > 1<<tableLog {
+			return nil, fmt.Errorf("readFSETable: frequencies exceed %d: %w", 1<<tableLog, ErrCorruptTable)
+		}
+		if norm[sym] != 0 {
+			continue
+		}
+		run, err := readGamma(r)
+		if err != nil {
+			return nil, fmt.Errorf("readFSETable: %w", err)
+		}
+		if int(run-1) >= symbols-sym {
+			return nil, fmt.Errorf("readFSETable: run of %d zeros: %w", run-1, ErrCorruptTable)
+		}
+		sym += int(run - 1)
+	}
+	if sum != 0 && sum != 1<<tableLog {
+		return nil, fmt.Errorf("readFSETable: frequencies sum to %d, not %d: %w", sum, 1<<tableLog, ErrCorruptTable)
+	}
+	return buildFSETable(norm, byte(tableLog)), nil
+}
+
+// writeGamma writes the Elias gamma code of v, which must be positive: the number of bits of v
+// minus one as zeros, followed by v.
+func writeGamma(w *bitio.Writer, v uint64) error {
+	n := byte(bits.Len64(v))
+	if err := w.WriteBits(0, n-1); err != nil {
+		return err
+	}
+	return w.WriteBits(v, n)
+}
+
+// readGamma reads an Elias gamma code of a value of at most 32 bits.
+// Returns:
+// - The value.
+// - An error wrapping ErrCorruptTable if the code is longer, or ErrTruncatedStream if r ends early.
+func readGamma(r *bitReader) (uint64, error) {
+	var zeros byte
+	for {
+		bit, err := r.ReadBool()
+		if err != nil {
+			return 0, truncated(err)
+		}
+		if bit {
+			break
+		}
+		if zeros++; zeros >= 32 {
+			return 0, fmt.Errorf("readGamma: code longer than 32 bits: %w", ErrCorruptTable)
+		}
+	}
+	rest, err := r.ReadBits(zeros)
+	if err != nil {
+		return 0, truncated(err)
+	}
+	return 1<<zeros | rest, nil
+}
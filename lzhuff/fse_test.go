@@ -0,0 +1,195 @@
+// fse_test.go
+// Package lzhuff contains tests for the tANS coder.
+// These tests verify that normalized frequencies fill the table and keep every symbol, that tables
+// survive serialization, that corrupt tables are rejected, and benchmark the tANS coder against
+// Huffman coding on the test corpus.
+
+package lzhuff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/icza/bitio"
+)
+
+// Test_normalizeFrequencies tests that normalized frequencies sum to the table size, keep every
+// symbol that occurs and only those.
+func Test_normalizeFrequencies(t *testing.T) {
+	skewed := make([]int, litLenSymbols)
+	skewed['a'], skewed['b'], skewed[litLenEOB] = 1000000, 3, 1
+	many := make([]int, litLenSymbols)
+	for i := range many {
+		many[i] = 1
+	}
+
+	tests := []struct {
+		name     string
+		freqs    []int
+		tableLog byte
+	}{
+		{name: "Single symbol", freqs: []int{0, 7, 0}, tableLog: fseMinTableLog},
+		{name: "Skewed", freqs: skewed, tableLog: fseMaxTableLog},
+		{name: "More symbols than the minimum table", freqs: many, tableLog: 9},
+		{name: "Empty", freqs: make([]int, 10), tableLog: fseMinTableLog},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			norm, tableLog := normalizeFrequencies(tt.freqs)
+			if tableLog != tt.tableLog {
+				t.Errorf("normalizeFrequencies() table log = %d; want %d", tableLog, tt.tableLog)
+			}
+			sum, total := 0, 0
+			for sym, n := range norm {
+				sum += n
+				total += tt.freqs[sym]
+				if (n == 0) != (tt.freqs[sym] == 0) {
+					t.Errorf("symbol %d: frequency %d normalized to %d", sym, tt.freqs[sym], n)
+				}
+			}
+			if total > 0 && sum != 1<<tableLog {
+				t.Errorf("normalized frequencies sum to %d; want %d", sum, 1<<tableLog)
+			}
+		})
+	}
+}
+
+// Test_fseTableSerialization tests that the tables of every corpus survive a round trip and
+// that frequencies not filling the table are rejected.
+func Test_fseTableSerialization(t *testing.T) {
+	for name, input := range testCorpus() {
+		tables := newFSETables(BytesToValues(input, 4, 255, 4096), nil)
+		for _, table := range tables.all() {
+			var buf bytes.Buffer
+			w := bitio.NewWriter(&buf)
+			if err := table.write(w); err != nil {
+				t.Fatalf("%s: fseTable.write() error = %v", name, err)
+			}
+			w.Close()
+
+			got, err := readFSETable(newBitReader(&buf), len(table.norm))
+			if err != nil {
+				t.Fatalf("%s: readFSETable() error = %v", name, err)
+			}
+			if got.tableLog != table.tableLog || !reflect.DeepEqual(got.norm, table.norm) {
+				t.Errorf("%s: readFSETable() = log %d %v; want log %d %v", name, got.tableLog, got.norm, table.tableLog, table.norm)
+			}
+		}
+	}
+
+	// A table of 32 states holding a single state.
+	var buf bytes.Buffer
+	w := bitio.NewWriter(&buf)
+	w.WriteBits(0, fseTableLogBits)
+	writeGamma(w, 2)
+	writeGamma(w, 1)
+	writeGamma(w, 2)
+	w.Close()
+	if _, err := readFSETable(newBitReader(&buf), 3); !errors.Is(err, ErrCorruptTable) {
+		t.Errorf("readFSETable() error = %v; want %v", err, ErrCorruptTable)
+	}
+}
+
+// Test_fseSkewedSymbols tests that the tANS coder spends far less than a bit on a very likely
+// symbol, which a Huffman code cannot.
+func Test_fseSkewedSymbols(t *testing.T) {
+	values := make([]Value, 100000)
+	for i := range values {
+		values[i] = NewValue(true, 'a', 0, 0)
+		if i%50 == 0 {
+			values[i] = NewValue(true, 'b', 0, 0)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeFSEBlock(&buf, values, nil); err != nil {
+		t.Fatalf("writeFSEBlock() error = %v", err)
+	}
+	if bits := buf.Len() * 8; bits >= len(values)/4 {
+		t.Errorf("writeFSEBlock() wrote %d bits for %d symbols", bits, len(values))
+	}
+
+	br := NewBinaryReader(&buf)
+	got, err := br.decodeFSEBlock(nil, len(values), 1)
+	if err != nil {
+		t.Fatalf("decodeFSEBlock() error = %v", err)
+	}
+	want, _ := ValuesToBytes(values)
+	if !bytes.Equal(got, want) {
+		t.Errorf("decodeFSEBlock() does not restore the values")
+	}
+}
+
+// Benchmark_entropyCoders benchmarks building the tables, encoding and decoding the values of the
+// test corpus with Huffman codes and with tANS codes.
+func Benchmark_entropyCoders(b *testing.B) {
+	input := testCorpus()["Words"]
+	values := BytesToValues(input, 4, 255, 4096)
+
+	var huffman, fse bytes.Buffer
+	bw := NewBinaryWriter(&huffman, constructHuffmanTrees(values, nil).codeTables(DefaultMaxCodeBits))
+	if err := bw.Write(values); err != nil {
+		b.Fatal(err)
+	}
+	if err := writeFSEBlock(&fse, values, nil); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Huffman/Tables", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			constructHuffmanTrees(values, nil).codeTables(DefaultMaxCodeBits)
+		}
+	})
+	b.Run("FSE/Tables", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			newFSETables(values, nil)
+		}
+	})
+	b.Run("Huffman/Encode", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		b.ReportMetric(float64(huffman.Len()), "compressed-bytes")
+		for n := 0; n < b.N; n++ {
+			bw := NewBinaryWriter(io.Discard, constructHuffmanTrees(values, nil).codeTables(DefaultMaxCodeBits))
+			if err := bw.Write(values); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("FSE/Encode", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		b.ReportMetric(float64(fse.Len()), "compressed-bytes")
+		for n := 0; n < b.N; n++ {
+			if err := writeFSEBlock(io.Discard, values, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Huffman/Decode", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		for n := 0; n < b.N; n++ {
+			br := NewBinaryReader(bytes.NewReader(huffman.Bytes()))
+			if err := br.readTables(1); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := br.decodeBlock(nil, len(input)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("FSE/Decode", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		for n := 0; n < b.N; n++ {
+			br := NewBinaryReader(bytes.NewReader(fse.Bytes()))
+			if _, err := br.decodeFSEBlock(nil, len(input), 1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,240 @@
+// fseblock.go
+// Package lzhuff provides the coding of the Values of a block with tANS codes, the block format of
+// CoderFSE. A block carries the normalized frequencies of the literal/length and distance alphabets
+// followed by a single bit stream in which the state bits of both alphabets and the extra bits are
+// interleaved. A tANS encoder works backwards, so the encoder walks the values from last to first,
+// stacks the bits it produces and writes the stack from the top: the decoder then reads the initial
+// states followed by the bits of every value in order.
+
+package lzhuff
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/icza/bitio"
+)
+
+// fseTables holds the tANS codes of the two alphabets of a block.
+// Every literal context has its own literal/length code and its own encoder and decoder state.
+type fseTables struct {
+	litLen    []*fseTable // Codes of the literal/length alphabet, indexed by literal context.
+	distances *fseTable   // Code of the distance alphabet, empty if the block has no pointers.
+}
+
+// newFSETables builds the tANS codes fitted to the statistics of values.
+// Parameters:
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+func newFSETables(values []Value, contexts []byte) fseTables {
+	litLen, distances := symbolFrequencies(values, contexts)
+	tables := fseTables{distances: newFSETable(distances)}
+	for _, freqs := range litLen {
+		tables.litLen = append(tables.litLen, newFSETable(freqs))
+	}
+	return tables
+}
+
+// all returns the literal/length tables followed by the distance table, in stream order.
+func (t fseTables) all() []*fseTable {
+	return append(append([]*fseTable{}, t.litLen...), t.distances)
+}
+
+// fseBits is a run of bits of the stream, stacked by the encoder before it is written.
+type fseBits struct {
+	v uint64 // The bits, the first one being the most significant of the n low bits.
+	n byte   // The number of bits.
+}
+
+// writeFSEBlock writes the tables and the values of a block, followed by the end-of-block marker,
+// as a byte-aligned bit stream.
+// Parameters:
+// - w: The destination of the block.
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+// Returns:
+// - An error if writing fails.
+func writeFSEBlock(w io.Writer, values []Value, contexts []byte) error {
+	tables := newFSETables(values, contexts)
+	bw := bitio.NewWriter(w)
+	for _, t := range tables.all() {
+		if err := t.write(bw); err != nil {
+			return fmt.Errorf("writeFSEBlock: %w", err)
+		}
+	}
+
+	stack := tables.encodeValues(values, contexts)
+	for i := len(stack) - 1; i >= 0; i-- {
+		if err := bw.WriteBits(stack[i].v, stack[i].n); err != nil {
+			return fmt.Errorf("writeFSEBlock: %w", err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		return fmt.Errorf("writeFSEBlock: closing bit writer: %w", err)
+	}
+	return nil
+}
+
+// encodeValues encodes values followed by the end-of-block marker, from last to first.
+// Returns:
+// - The bits of the stream in reverse order: the initial states come last.
+func (t fseTables) encodeValues(values []Value, contexts []byte) []fseBits {
+	stack := make([]fseBits, 0, 2*len(values)+4)
+	litStates := make([]uint32, len(t.litLen))
+	for ctx, table := range t.litLen {
+		litStates[ctx] = table.initialState()
+	}
+	distState := t.distances.initialState()
+	dists := encodeDistances(values)
+	var low uint64
+	var n byte
+	for i := len(values); i >= 0; i-- {
+		v := endOfBlock
+		if i < len(values) {
+			v = values[i]
+		}
+		ctx := contextOf(contexts, i)
+		litLen, litState := t.litLen[ctx], &litStates[ctx]
+		switch {
+		case v.IsLiteral:
+			*litState, low, n = litLen.encodeSymbol(*litState, int(v.val))
+		case v.isEndOfBlock():
+			*litState, low, n = litLen.encodeSymbol(*litState, litLenEOB)
+		default:
+			// The decoder reads the length before the distance, so the distance is stacked first.
+			dist := dists[i]
+			stack = append(stack, fseBits{v: dist.extra, n: dist.extraBits})
+			distState, low, n = t.distances.encodeSymbol(distState, dist.sym)
+			stack = append(stack, fseBits{v: low, n: n})
+			sym, extra, extraBits := lengthSymbol(int(v.length))
+			stack = append(stack, fseBits{v: extra, n: extraBits})
+			*litState, low, n = litLen.encodeSymbol(*litState, sym)
+		}
+		stack = append(stack, fseBits{v: low, n: n})
+	}
+
+	// The decoder reads the initial states in the order of the tables.
+	states := append(litStates, distState)
+	tables := t.all()
+	for i := len(tables) - 1; i >= 0; i-- {
+		if !tables[i].empty() {
+			stack = append(stack, fseBits{v: uint64(states[i] - tables[i].initialState()), n: tables[i].tableLog})
+		}
+	}
+	return stack
+}
+
+// fseDecoder decodes the symbols of one alphabet of a block written by writeFSEBlock.
+type fseDecoder struct {
+	t     *fseTable // The code of the alphabet.
+	state uint32    // The current state, an index into the decoding table of t.
+}
+
+// newFSEDecoder reads the initial state of t from r.
+// A decoder of an empty table reads nothing and fails to decode.
+func newFSEDecoder(r *bitReader, t *fseTable) (fseDecoder, error) {
+	if t.empty() {
+		return fseDecoder{t: t}, nil
+	}
+	state, err := r.ReadBits(t.tableLog)
+	if err != nil {
+		return fseDecoder{}, truncated(err)
+	}
+	return fseDecoder{t: t, state: uint32(state)}, nil
+}
+
+// decode decodes a symbol and moves to the next state.
+// Returns:
+// - The symbol.
+// - An error wrapping ErrCorruptStream if the table is empty, or ErrTruncatedStream if r ends
+// early.
+func (d *fseDecoder) decode(r *bitReader) (int, error) {
+	if d.t.empty() {
+		return 0, fmt.Errorf("fseDecoder.decode: symbol of an empty alphabet: %w", ErrCorruptStream)
+	}
+	e := d.t.decode[d.state]
+	low, err := r.ReadBits(e.nbBits)
+	if err != nil {
+		return 0, truncated(err)
+	}
+	d.state = e.base + uint32(low)
+	return int(e.sym), nil
+}
+
+// decodeFSEBlock reads the tables and decodes the values of a block written by writeFSEBlock,
+// appending the bytes they stand for to window like decodeBlock.
+// Parameters:
+// - window: The search window preceding the block.
+// - limit: The number of bytes the block may decode to.
+// - contexts: The number of literal/length tables, 1 without literal contexts.
+// Returns:
+// - window extended with the bytes of the block.
+// - An error wrapping ErrCorruptTable if a table is malformed, ErrCorruptStream if a symbol or
+// value is out of range, ErrInvalidDistance if a pointer reaches before the window,
+// ErrSizeMismatch if the block exceeds limit, or ErrTruncatedStream if r ends early.
+func (br *BinaryReader) decodeFSEBlock(window []byte, limit, contexts int) ([]byte, error) {
+	tables := make([]*fseTable, contexts+1)
+	for i := range tables {
+		symbols := litLenSymbols
+		if i == contexts {
+			symbols = distanceSymbols
+		}
+		table, err := readFSETable(br.r, symbols)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: %w", err)
+		}
+		tables[i] = table
+	}
+	decoders := make([]fseDecoder, len(tables))
+	for i, table := range tables {
+		d, err := newFSEDecoder(br.r, table)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: %w", err)
+		}
+		decoders[i] = d
+	}
+	litLen, distances := decoders[:contexts], &decoders[contexts]
+
+	end := len(window) + limit
+	reps := newRepDistances()
+	for {
+		ctx := 0
+		if contexts > 1 {
+			ctx = windowContext(window)
+		}
+		sym, err := litLen[ctx].decode(br.r)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: %w", err)
+		}
+		if sym == litLenEOB {
+			return window, nil
+		}
+		if len(window) == end {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: block exceeds %d bytes: %w", limit, ErrSizeMismatch)
+		}
+		if sym < litLenEOB {
+			window = append(window, byte(sym))
+			continue
+		}
+
+		length, err := br.readExtra(lengthCode, sym-litLenEOB-1)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: %w", truncated(err))
+		}
+		sym, err = distances.decode(br.r)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: %w", err)
+		}
+		distance, err := br.readDistance(sym, &reps)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: %w", truncated(err))
+		}
+		if distance > len(window) {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: distance %d with %d bytes of output: %w", distance, len(window), ErrInvalidDistance)
+		}
+		if length > end-len(window) {
+			return nil, fmt.Errorf("BinaryReader.decodeFSEBlock: block exceeds %d bytes: %w", limit, ErrSizeMismatch)
+		}
+		window = appendMatch(window, distance, length)
+	}
+}
@@ -0,0 +1,363 @@
+// gzip.go
+// Package lzhuff provides GzipWriter, which wraps the raw DEFLATE stream of DeflateWriter in the
+// gzip file format (RFC 1952): a header recording the name and modification time of the original
+// file, followed by the compressed data and a trailer holding the CRC-32 and the length of the
+// uncompressed data. The files it writes open with gunzip and compress/gzip. GzipReader reads
+// them back, as well as the files of gzip and compress/gzip, with DeflateReader.
+
+package lzhuff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Fields of the gzip header.
+const (
+	gzipID1         = 0x1f // First magic byte.
+	gzipID2         = 0x8b // Second magic byte.
+	gzipDeflate     = 8    // Compression method of DEFLATE, shared with zlib.
+	gzipFlagHCRC    = 0x02 // Flag of a header ending with the CRC-16 of the header.
+	gzipFlagExtra   = 0x04 // Flag of a header holding an extra field.
+	gzipFlagName    = 0x08 // Flag of a header holding the original file name.
+	gzipFlagComment = 0x10 // Flag of a header holding a comment.
+	gzipFlagsKnown  = 0x1f // Flags defined by RFC 1952, including FTEXT, which needs no handling.
+	gzipHeaderSize  = 10   // Size of the fixed part of the header.
+	gzipTrailerSize = 8    // Size of the trailer.
+	gzipXFLBest     = 2    // Extra flags of the slowest, best compression.
+	gzipXFLFast     = 4    // Extra flags of the fastest compression.
+	gzipOSUnknown   = 255  // Operating system of the file system the file came from, unknown.
+)
+
+// WithFileName records the name of the original file in the header of a gzip stream, for gunzip
+// to restore. The header stores the name in ISO 8859-1 (Latin-1): a name holding a NUL byte or a
+// character outside that set is left out, so the stream still decodes and gunzip names the output
+// after the compressed file. It has no effect on the other formats.
+func WithFileName(name string) Option {
+	return func(c *config) error {
+		c.fileName = name
+		return nil
+	}
+}
+
+// WithModTime records the modification time of the original file in the header of a gzip stream.
+// A zero time, the default, or a time before 1970 records none. It has no effect on the other
+// formats.
+func WithModTime(t time.Time) Option {
+	return func(c *config) error {
+		c.modTime = t
+		return nil
+	}
+}
+
+// GzipWriter is an io.WriteCloser that compresses the data written to it into a gzip stream with
+// a single member.
+type GzipWriter struct {
+	frameWriter
+}
+
+// NewGzipWriter returns a new GzipWriter compressing data to w.
+// It accepts the options of NewDeflateWriter, together with WithFileName and WithModTime.
+// Parameters:
+// - w: The io.Writer that receives the compressed stream.
+// - opts: Options overriding the default compression settings.
+func NewGzipWriter(w io.Writer, opts ...Option) (*GzipWriter, error) {
+	zw, err := NewDeflateWriter(w, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GzipWriter{frameWriter{
+		deflate: zw,
+		header:  gzipHeader(&zw.cfg),
+		sum:     crc32.NewIEEE(),
+		trailer: gzipTrailer,
+	}}, nil
+}
+
+// gzipHeader returns the gzip header of a stream written with the settings of c. The file name is
+// recorded only if it can be stored in Latin-1.
+func gzipHeader(c *config) []byte {
+	header := make([]byte, gzipHeaderSize, gzipHeaderSize+len(c.fileName)+1)
+	header[0], header[1], header[2], header[9] = gzipID1, gzipID2, gzipDeflate, gzipOSUnknown
+	if !c.modTime.IsZero() && c.modTime.Unix() > 0 {
+		binary.LittleEndian.PutUint32(header[4:], uint32(c.modTime.Unix()))
+	}
+	switch c.level {
+	case MinLevel:
+		header[8] = gzipXFLFast
+	case MaxLevel:
+		header[8] = gzipXFLBest
+	}
+	if name, ok := latin1(c.fileName); ok && len(name) > 0 {
+		header[3] |= gzipFlagName
+		header = append(header, name...)
+		header = append(header, 0)
+	}
+	return header
+}
+
+// latin1 returns the ISO 8859-1 encoding of s.
+// Returns:
+// - The encoded bytes.
+// - false if s holds a NUL byte or a character outside ISO 8859-1.
+func latin1(s string) ([]byte, bool) {
+	encoded := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r == 0 || r > 0xff {
+			return nil, false
+		}
+		encoded = append(encoded, byte(r))
+	}
+	return encoded, true
+}
+
+// gzipTrailer returns the gzip trailer: the CRC-32 and the length modulo 1<<32 of the
+// uncompressed data, little-endian.
+func gzipTrailer(sum uint32, size uint64) []byte {
+	trailer := make([]byte, gzipTrailerSize)
+	binary.LittleEndian.PutUint32(trailer, sum)
+	binary.LittleEndian.PutUint32(trailer[4:], uint32(size))
+	return trailer
+}
+
+// frameWriter wraps the stream of a DeflateWriter in the header and the trailer of a container
+// format. The trailer holds a checksum of the uncompressed data.
+type frameWriter struct {
+	deflate *DeflateWriter                       // Compressor of the data between header and trailer.
+	header  []byte                               // Header, written before the compressed data.
+	sum     hash.Hash32                          // Checksum of the uncompressed data written so far.
+	trailer func(sum uint32, size uint64) []byte // Builds the trailer from the checksum and the length.
+	started bool                                 // Whether the header has been written.
+	closed  bool                                 // Whether Close has already been called.
+	err     error                                // First error encountered, returned by every later call.
+}
+
+// Write compresses p. It implements io.Writer.
+func (f *frameWriter) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.closed {
+		return 0, errors.New("lzhuff: write to closed Writer")
+	}
+	if f.err = f.writeHeader(); f.err != nil {
+		return 0, f.err
+	}
+	n, err := f.deflate.Write(p)
+	f.sum.Write(p[:n])
+	f.err = err
+	return n, err
+}
+
+// Close compresses the remaining data and writes the trailer. It does not close the underlying
+// io.Writer.
+func (f *frameWriter) Close() error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	if f.err = f.writeHeader(); f.err != nil {
+		return f.err
+	}
+	if f.err = f.deflate.Close(); f.err != nil {
+		return f.err
+	}
+	if _, err := f.deflate.w.Write(f.trailer(f.sum.Sum32(), f.deflate.size)); err != nil {
+		f.err = fmt.Errorf("frameWriter.Close: writing trailer: %w", err)
+	}
+	return f.err
+}
+
+// writeHeader writes the header before the first compressed byte.
+func (f *frameWriter) writeHeader() error {
+	if f.started {
+		return nil
+	}
+	f.started = true
+	if _, err := f.deflate.w.Write(f.header); err != nil {
+		return fmt.Errorf("frameWriter.writeHeader: %w", err)
+	}
+	return nil
+}
+
+// GzipHeader holds the fields of a gzip header that describe the original file.
+type GzipHeader struct {
+	Name    string    // Name of the original file, or "" if none is recorded.
+	Comment string    // Comment on the file, or "" if none is recorded.
+	ModTime time.Time // Modification time of the original file, or the zero time if none is recorded.
+	OS      byte      // Operating system of the file system the file came from.
+}
+
+// GzipReader is an io.Reader that decompresses a gzip stream read from an underlying io.Reader.
+// Like gunzip, it decodes every member of a stream made of several concatenated members.
+type GzipReader struct {
+	r       *bitReader     // Bit-level reader over the compressed stream.
+	header  GzipHeader     // Header of the current member.
+	inflate *DeflateReader // Decoder of the compressed data of the current member.
+	crc     uint32         // CRC-32 of the uncompressed bytes of the current member.
+	size    uint64         // Number of uncompressed bytes of the current member.
+	done    bool           // Whether the last member has been decoded and verified.
+	err     error          // Error encountered while decoding, returned by every later Read.
+}
+
+// NewGzipReader returns a new GzipReader decompressing data from r.
+// It reads and validates the header of the first member before returning.
+// Parameters:
+// - r: The io.Reader providing the compressed stream.
+// Returns:
+// - The GzipReader.
+// - An error wrapping ErrInvalidHeader, ErrUnsupportedVersion, ErrChecksum or ErrTruncatedStream
+// if the header cannot be used.
+func NewGzipReader(r io.Reader) (*GzipReader, error) {
+	z := &GzipReader{r: newLSBBitReader(r)}
+	if err := z.readHeader(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Header returns the header of the member being decoded.
+func (z *GzipReader) Header() GzipHeader {
+	return z.header
+}
+
+// Read reads decompressed data into p. It implements io.Reader.
+// The CRC-32 and the length of every member are verified once the member is decoded, so Read
+// only returns io.EOF for an intact stream.
+func (z *GzipReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, z.err
+	}
+	for {
+		if z.err != nil {
+			return 0, z.err
+		}
+		if z.done {
+			return 0, io.EOF
+		}
+		n, err := z.inflate.Read(p)
+		z.crc = crc32.Update(z.crc, crc32.IEEETable, p[:n])
+		z.size += uint64(n)
+		if err == io.EOF {
+			z.err = z.endMember()
+		} else {
+			z.err = err
+		}
+		// Read returns once it has decoded a byte. At the end of the data of a member, it goes on
+		// with the next member or returns io.EOF or the error.
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// readHeader reads the header of the next member and prepares the decoding of its data.
+func (z *GzipReader) readHeader() error {
+	header := make([]byte, gzipHeaderSize)
+	if _, err := io.ReadFull(z.r, header); err != nil {
+		return fmt.Errorf("GzipReader.readHeader: %w", truncated(err))
+	}
+	if header[0] != gzipID1 || header[1] != gzipID2 {
+		return fmt.Errorf("GzipReader.readHeader: magic bytes %x: %w", header[:2], ErrInvalidHeader)
+	}
+	flags := header[3]
+	if header[2] != gzipDeflate || flags&^gzipFlagsKnown != 0 {
+		return fmt.Errorf("GzipReader.readHeader: compression method %d with flags %#x: %w", header[2], flags, ErrUnsupportedVersion)
+	}
+	// The optional fields are part of the header checksum.
+	crc := crc32.Update(0, crc32.IEEETable, header)
+	readByte := func() (byte, error) {
+		c, err := z.r.ReadByte()
+		crc = crc32.Update(crc, crc32.IEEETable, []byte{c})
+		return c, truncated(err)
+	}
+	readString := func() (string, error) {
+		var runes []rune
+		for {
+			c, err := readByte()
+			if err != nil || c == 0 {
+				return string(runes), err
+			}
+			// Header strings are ISO 8859-1, whose characters are the first 256 of Unicode.
+			runes = append(runes, rune(c))
+		}
+	}
+
+	z.header = GzipHeader{OS: header[9]}
+	if mtime := binary.LittleEndian.Uint32(header[4:]); mtime != 0 {
+		z.header.ModTime = time.Unix(int64(mtime), 0)
+	}
+	if flags&gzipFlagExtra != 0 {
+		lo, err := readByte()
+		if err != nil {
+			return fmt.Errorf("GzipReader.readHeader: reading extra field: %w", err)
+		}
+		hi, err := readByte()
+		for n := int(hi)<<8 | int(lo); n > 0 && err == nil; n-- {
+			_, err = readByte()
+		}
+		if err != nil {
+			return fmt.Errorf("GzipReader.readHeader: reading extra field: %w", err)
+		}
+	}
+	var err error
+	if flags&gzipFlagName != 0 {
+		if z.header.Name, err = readString(); err != nil {
+			return fmt.Errorf("GzipReader.readHeader: reading file name: %w", err)
+		}
+	}
+	if flags&gzipFlagComment != 0 {
+		if z.header.Comment, err = readString(); err != nil {
+			return fmt.Errorf("GzipReader.readHeader: reading comment: %w", err)
+		}
+	}
+	if flags&gzipFlagHCRC != 0 {
+		want := uint16(crc)
+		lo, err := readByte()
+		if err != nil {
+			return fmt.Errorf("GzipReader.readHeader: reading header checksum: %w", err)
+		}
+		hi, err := readByte()
+		if err != nil {
+			return fmt.Errorf("GzipReader.readHeader: reading header checksum: %w", err)
+		}
+		if got := uint16(hi)<<8 | uint16(lo); got != want {
+			return fmt.Errorf("GzipReader.readHeader: header checksum %#04x, computed %#04x: %w", got, want, ErrChecksum)
+		}
+	}
+
+	z.inflate = newDeflateReader(z.r)
+	z.crc, z.size = 0, 0
+	return nil
+}
+
+// endMember verifies the trailer of the member just decoded and reads the header of the next
+// member, if any follows.
+func (z *GzipReader) endMember() error {
+	z.r.Align()
+	trailer := make([]byte, gzipTrailerSize)
+	if _, err := io.ReadFull(z.r, trailer); err != nil {
+		return fmt.Errorf("GzipReader.endMember: reading trailer: %w", truncated(err))
+	}
+	if crc := binary.LittleEndian.Uint32(trailer); crc != z.crc {
+		return fmt.Errorf("GzipReader.endMember: stored CRC-32 %#08x, computed %#08x: %w", crc, z.crc, ErrChecksum)
+	}
+	if size := binary.LittleEndian.Uint32(trailer[4:]); size != uint32(z.size) {
+		return fmt.Errorf("GzipReader.endMember: stored length %d, decoded %d bytes: %w", size, z.size, ErrSizeMismatch)
+	}
+
+	if _, avail := z.r.peek(8); avail == 0 && z.r.err == io.EOF {
+		z.done = true
+		return nil
+	}
+	return z.readHeader()
+}
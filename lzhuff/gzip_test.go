@@ -0,0 +1,233 @@
+// gzip_test.go
+// Package lzhuff contains tests for the gzip format.
+// These tests verify that compress/gzip reads the data, the file name and the modification time
+// back from the streams written by GzipWriter, that names a gzip header cannot hold are left out,
+// and that GzipReader decodes the streams of compress/gzip and rejects corrupt ones.
+
+package lzhuff
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+	"time"
+)
+
+// Test_GzipWriter tests that compress/gzip restores the input and the header fields.
+func Test_GzipWriter(t *testing.T) {
+	modTime := time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		input    []byte
+		opts     []Option
+		wantName string
+		wantTime time.Time
+	}{
+		{name: "No header fields", input: testCorpus()["Words"]},
+		{name: "File name and time", input: testCorpus()["Words"], opts: []Option{WithFileName("words.txt"), WithModTime(modTime)}, wantName: "words.txt", wantTime: modTime},
+		{name: "Latin-1 file name", input: []byte("données"), opts: []Option{WithFileName("données.txt")}, wantName: "données.txt"},
+		{name: "CJK file name", input: []byte("日本語"), opts: []Option{WithFileName("日本.txt"), WithModTime(modTime)}, wantTime: modTime},
+		{name: "File name with a NUL byte", input: []byte("nul"), opts: []Option{WithFileName("nul\x00name")}},
+		{name: "Empty input", input: nil, opts: []Option{WithLevel(MaxLevel)}},
+		{name: "Several blocks", input: testCorpus()["Small alphabet"], opts: []Option{WithBlockSize(3000), WithLevel(MinLevel)}},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			var compressed bytes.Buffer
+			zw, err := NewGzipWriter(&compressed, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewGzipWriter() error = %v", err)
+			}
+			if _, err := zw.Write(tt.input); err != nil {
+				t.Fatalf("GzipWriter.Write() error = %v", err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("GzipWriter.Close() error = %v", err)
+			}
+
+			zr, err := gzip.NewReader(&compressed)
+			if err != nil {
+				t.Fatalf("gzip.NewReader() error = %v", err)
+			}
+			zr.Multistream(false)
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("gzip reader error = %v", err)
+			}
+			if !bytes.Equal(got, tt.input) {
+				t.Errorf("gzip reader does not restore the input")
+			}
+			if zr.Name != tt.wantName {
+				t.Errorf("Name = %q; want %q", zr.Name, tt.wantName)
+			}
+			if !zr.ModTime.Equal(tt.wantTime) {
+				t.Errorf("ModTime = %v; want %v", zr.ModTime, tt.wantTime)
+			}
+			if compressed.Len() != 0 {
+				t.Errorf("%d bytes follow the gzip member", compressed.Len())
+			}
+		})
+	}
+}
+
+// gzipCompress compresses input with compress/gzip at the given level, recording header.
+func gzipCompress(t *testing.T, input []byte, level int, header gzip.Header) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&compressed, level)
+	if err != nil {
+		t.Fatalf("gzip.NewWriterLevel() error = %v", err)
+	}
+	zw.Header = header
+	zw.Write(input)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip writer error = %v", err)
+	}
+	return compressed.Bytes()
+}
+
+// readAllChecked reads r to the end like io.ReadAll, with a buffer small enough to take several
+// calls per block, and fails if a Read returns neither a byte nor an error.
+func readAllChecked(t *testing.T, r io.Reader) ([]byte, error) {
+	t.Helper()
+	var out []byte
+	buf := make([]byte, 100)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		if n == 0 {
+			t.Fatalf("Read() returned no byte and no error after %d bytes", len(out))
+		}
+	}
+}
+
+// Test_GzipReader tests that GzipReader restores the data and the header fields of the streams of
+// compress/gzip, of GzipWriter and of several concatenated members.
+func Test_GzipReader(t *testing.T) {
+	input := testCorpus()["Words"]
+	header := gzip.Header{
+		Name:    "words.txt",
+		Comment: "à la carte",
+		Extra:   []byte("extra field"),
+		ModTime: time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC),
+		OS:      3,
+	}
+	wantHeader := GzipHeader{Name: header.Name, Comment: header.Comment, ModTime: header.ModTime, OS: header.OS}
+
+	// A header with a CRC-16, which compress/gzip does not write.
+	withHCRC := []byte{gzipID1, gzipID2, gzipDeflate, gzipFlagHCRC, 0, 0, 0, 0, 0, gzipOSUnknown}
+	withHCRC = binary.LittleEndian.AppendUint16(withHCRC, uint16(crc32.ChecksumIEEE(withHCRC)))
+	var raw bytes.Buffer
+	fw, _ := flate.NewWriter(&raw, flate.BestSpeed)
+	fw.Write(input)
+	fw.Close()
+	withHCRC = append(withHCRC, raw.Bytes()...)
+	withHCRC = append(withHCRC, gzipTrailer(crc32.ChecksumIEEE(input), uint64(len(input)))...)
+
+	var ours bytes.Buffer
+	zw, err := NewGzipWriter(&ours, WithFileName(header.Name), WithModTime(header.ModTime))
+	if err != nil {
+		t.Fatalf("NewGzipWriter() error = %v", err)
+	}
+	zw.Write(input)
+	zw.Close()
+
+	tests := []struct {
+		name       string
+		compressed []byte
+		want       []byte
+		wantHeader GzipHeader
+	}{
+		{name: "Stored", compressed: gzipCompress(t, input, gzip.NoCompression, header), want: input, wantHeader: wantHeader},
+		{name: "Fastest", compressed: gzipCompress(t, input, gzip.BestSpeed, header), want: input, wantHeader: wantHeader},
+		{name: "Best", compressed: gzipCompress(t, input, gzip.BestCompression, header), want: input, wantHeader: wantHeader},
+		{name: "Huffman only", compressed: gzipCompress(t, input, gzip.HuffmanOnly, header), want: input, wantHeader: wantHeader},
+		{name: "Empty", compressed: gzipCompress(t, nil, gzip.DefaultCompression, gzip.Header{OS: 255}), want: nil, wantHeader: GzipHeader{OS: 255}},
+		{name: "Header checksum", compressed: withHCRC, want: input, wantHeader: GzipHeader{OS: gzipOSUnknown}},
+		{name: "GzipWriter", compressed: ours.Bytes(), want: input, wantHeader: GzipHeader{Name: header.Name, ModTime: header.ModTime, OS: gzipOSUnknown}},
+		{
+			name:       "Two members",
+			compressed: append(gzipCompress(t, input[:100], gzip.BestSpeed, header), gzipCompress(t, input[100:], gzip.BestSpeed, header)...),
+			want:       input,
+			wantHeader: wantHeader,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			zr, err := NewGzipReader(bytes.NewReader(tt.compressed))
+			if err != nil {
+				t.Fatalf("NewGzipReader() error = %v", err)
+			}
+			got, err := readAllChecked(t, zr)
+			if err != nil {
+				t.Fatalf("GzipReader.Read() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("GzipReader does not restore the input")
+			}
+			if h := zr.Header(); h.Name != tt.wantHeader.Name || h.Comment != tt.wantHeader.Comment || !h.ModTime.Equal(tt.wantHeader.ModTime) || h.OS != tt.wantHeader.OS {
+				t.Errorf("Header() = %+v; want %+v", h, tt.wantHeader)
+			}
+		})
+	}
+}
+
+// Test_GzipReaderCorrupt tests that corrupt gzip streams fail with the matching sentinel error.
+func Test_GzipReaderCorrupt(t *testing.T) {
+	valid := gzipCompress(t, testCorpus()["Words"], gzip.DefaultCompression, gzip.Header{Name: "words.txt"})
+	corrupt := func(i int) []byte {
+		c := append([]byte{}, valid...)
+		c[i] ^= 0x01
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{name: "Magic bytes", input: corrupt(0), wantErr: ErrInvalidHeader},
+		{name: "Compression method", input: corrupt(2), wantErr: ErrUnsupportedVersion},
+		{name: "Header truncated in file name", input: valid[:gzipHeaderSize+4], wantErr: ErrTruncatedStream},
+		{name: "Data truncated", input: valid[:len(valid)/2], wantErr: ErrTruncatedStream},
+		{name: "Trailer truncated", input: valid[:len(valid)-2], wantErr: ErrTruncatedStream},
+		{name: "CRC-32", input: corrupt(len(valid) - gzipTrailerSize), wantErr: ErrChecksum},
+		{name: "Length", input: corrupt(len(valid) - 1), wantErr: ErrSizeMismatch},
+		{name: "Trailing garbage", input: append(append([]byte{}, valid...), "trailing garbage"...), wantErr: ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			zr, err := NewGzipReader(bytes.NewReader(tt.input))
+			if err == nil {
+				_, err = io.ReadAll(zr)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GzipReader error = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// header.go
+// Package lzhuff provides the container framing of a compressed stream: the header written at its
+// start, the header of every block, and the trailer written at its end. The header identifies the
+// format with magic bytes, records the format version and the LZ77 parameters used by the encoder,
+// and stores the length of the uncompressed data when it is known up front. Both the header and
+// the uncompressed data are protected by CRC-32 checksums.
+
+package lzhuff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// magic identifies a stream produced by this package.
+const magic = "LZHF"
+
+// formatVersion is the version of the bitstream written by this package.
+// It is incremented whenever the layout of the stream changes incompatibly.
+const formatVersion = 11
+
+// Header flags.
+const (
+	// FlagContentSize is set when Header.Size holds the length of the uncompressed data.
+	FlagContentSize = 1 << 0
+)
+
+// knownFlags is the set of header flags understood by this version of the package.
+// Streams with any other flag set are rejected.
+const knownFlags = FlagContentSize
+
+// headerSize is the size of the serialized Header in bytes, including its trailing CRC-32.
+const headerSize = len(magic) + 1 + 1 + 1 + 2 + 2 + 4 + 8 + 4
+
+// trailerSize is the size of the serialized trailer in bytes.
+const trailerSize = 4 + 8
+
+// blockHeaderSize is the size of the serialized header of a block in bytes.
+const blockHeaderSize = 1 + 4
+
+// Block header flags.
+const (
+	blockLast       = 1 << 0 // The block is the final block of the stream.
+	blockReuseTable = 1 << 1 // The block has no code table and reuses the one of the previous block.
+	blockLiteralCtx = 1 << 2 // Literal/length symbols are coded in the context of the previous byte.
+)
+
+// knownBlockFlags is the set of block header flags understood by this version of the package.
+const knownBlockFlags = blockLast | blockReuseTable | blockLiteralCtx
+
+// maxBlockSize is the largest uncompressed block length a Reader accepts.
+const maxBlockSize = 1 << 26
+
+// Header describes a compressed stream.
+type Header struct {
+	Version    byte   // Format version of the stream.
+	Flags      byte   // Feature flags, a combination of the Flag constants.
+	Coder      Coder  // Entropy coder of the blocks.
+	MinMatch   uint16 // Minimum match length used by the encoder.
+	MaxMatch   uint16 // Maximum match length used by the encoder.
+	SearchSize uint32 // Size of the search window used by the encoder, at most MaxSearchSize.
+	Size       uint64 // Length of the uncompressed data in bytes, if Flags has FlagContentSize.
+}
+
+// blockHeader describes a block of the compressed stream.
+type blockHeader struct {
+	last       bool   // Whether this is the final block of the stream.
+	reuseTable bool   // Whether the block reuses the code table of the previous block.
+	literalCtx bool   // Whether literal/length symbols are coded in literal contexts.
+	size       uint32 // Length of the uncompressed data of the block in bytes.
+}
+
+// contexts returns the number of literal/length codes or models the block is coded with.
+func (bh blockHeader) contexts() int {
+	if bh.literalCtx {
+		return literalContexts
+	}
+	return 1
+}
+
+// writeHeader serializes h to w, prefixed by the magic bytes and followed by the CRC-32
+// of everything before it. Multi-byte fields are stored in big-endian order.
+func writeHeader(w io.Writer, h Header) error {
+	buf := make([]byte, headerSize)
+	n := copy(buf, magic)
+	buf[n] = h.Version
+	buf[n+1] = h.Flags
+	buf[n+2] = byte(h.Coder)
+	binary.BigEndian.PutUint16(buf[n+3:], h.MinMatch)
+	binary.BigEndian.PutUint16(buf[n+5:], h.MaxMatch)
+	binary.BigEndian.PutUint32(buf[n+7:], h.SearchSize)
+	binary.BigEndian.PutUint64(buf[n+11:], h.Size)
+	binary.BigEndian.PutUint32(buf[headerSize-4:], crc32.ChecksumIEEE(buf[:headerSize-4]))
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writeHeader: %w", err)
+	}
+	return nil
+}
+
+// readHeader deserializes a Header from r.
+// Returns:
+// - The decoded Header.
+// - An error wrapping ErrInvalidHeader if the magic bytes do not match, ErrUnsupportedVersion
+// if the version, flags, coder or search size are not supported, ErrChecksum if the header is
+// damaged, or ErrTruncatedStream if r ends early.
+func readHeader(r io.Reader) (Header, error) {
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return Header{}, fmt.Errorf("readHeader: %w", truncated(err))
+	}
+	if string(buf[:len(magic)]) != magic {
+		return Header{}, fmt.Errorf("readHeader: magic %q: %w", buf[:len(magic)], ErrInvalidHeader)
+	}
+
+	n := len(magic)
+	h := Header{
+		Version:    buf[n],
+		Flags:      buf[n+1],
+		Coder:      Coder(buf[n+2]),
+		MinMatch:   binary.BigEndian.Uint16(buf[n+3:]),
+		MaxMatch:   binary.BigEndian.Uint16(buf[n+5:]),
+		SearchSize: binary.BigEndian.Uint32(buf[n+7:]),
+		Size:       binary.BigEndian.Uint64(buf[n+11:]),
+	}
+	if h.Version != formatVersion {
+		return Header{}, fmt.Errorf("readHeader: version %d: %w", h.Version, ErrUnsupportedVersion)
+	}
+	if h.Flags&^knownFlags != 0 {
+		return Header{}, fmt.Errorf("readHeader: flags %08b: %w", h.Flags, ErrUnsupportedVersion)
+	}
+	if got, want := crc32.ChecksumIEEE(buf[:headerSize-4]), binary.BigEndian.Uint32(buf[headerSize-4:]); got != want {
+		return Header{}, fmt.Errorf("readHeader: header CRC-32 %08x, stored %08x: %w", got, want, ErrChecksum)
+	}
+	if _, ok := coderNames[h.Coder]; !ok {
+		return Header{}, fmt.Errorf("readHeader: coder %d: %w", byte(h.Coder), ErrUnsupportedVersion)
+	}
+	if h.SearchSize > MaxSearchSize {
+		return Header{}, fmt.Errorf("readHeader: search size %d exceeds %d: %w", h.SearchSize, MaxSearchSize, ErrUnsupportedVersion)
+	}
+	return h, nil
+}
+
+// writeBlockHeader serializes the header of a block to w.
+func writeBlockHeader(w io.Writer, bh blockHeader) error {
+	buf := make([]byte, blockHeaderSize)
+	if bh.last {
+		buf[0] |= blockLast
+	}
+	if bh.reuseTable {
+		buf[0] |= blockReuseTable
+	}
+	if bh.literalCtx {
+		buf[0] |= blockLiteralCtx
+	}
+	binary.BigEndian.PutUint32(buf[1:], bh.size)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writeBlockHeader: %w", err)
+	}
+	return nil
+}
+
+// parseBlockHeader decodes the header of a block from buf.
+// Returns:
+// - The decoded blockHeader.
+// - An error wrapping ErrCorruptStream if the flags are unknown or the block is too large.
+func parseBlockHeader(buf []byte) (blockHeader, error) {
+	if buf[0]&^knownBlockFlags != 0 {
+		return blockHeader{}, fmt.Errorf("parseBlockHeader: flags %08b: %w", buf[0], ErrCorruptStream)
+	}
+	bh := blockHeader{
+		last:       buf[0]&blockLast != 0,
+		reuseTable: buf[0]&blockReuseTable != 0,
+		literalCtx: buf[0]&blockLiteralCtx != 0,
+		size:       binary.BigEndian.Uint32(buf[1:]),
+	}
+	if bh.size > maxBlockSize {
+		return blockHeader{}, fmt.Errorf("parseBlockHeader: block of %d bytes: %w", bh.size, ErrCorruptStream)
+	}
+	return bh, nil
+}
+
+// writeTrailer writes the trailer that closes a stream: the CRC-32 (IEEE) and the length of the
+// uncompressed data.
+func writeTrailer(w io.Writer, checksum uint32, size uint64) error {
+	buf := make([]byte, trailerSize)
+	binary.BigEndian.PutUint32(buf, checksum)
+	binary.BigEndian.PutUint64(buf[4:], size)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("writeTrailer: %w", err)
+	}
+	return nil
+}
+
+// verifyTrailer decodes a trailer from buf and compares it with the CRC-32 and the length of the
+// decompressed data.
+// Returns:
+// - An error wrapping ErrSizeMismatch if the lengths differ, or ErrChecksum if the checksums differ.
+func verifyTrailer(buf []byte, checksum uint32, size uint64) error {
+	if want := binary.BigEndian.Uint64(buf[4:]); size != want {
+		return fmt.Errorf("verifyTrailer: decoded %d bytes, trailer says %d: %w", size, want, ErrSizeMismatch)
+	}
+	if want := binary.BigEndian.Uint32(buf); checksum != want {
+		return fmt.Errorf("verifyTrailer: data CRC-32 %08x, stored %08x: %w", checksum, want, ErrChecksum)
+	}
+	return nil
+}
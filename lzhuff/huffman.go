@@ -0,0 +1,403 @@
+// huffman.go
+// Package lzhuff provides functionality for constructing a Huffman tree, generating a code table,
+// and handling serialization for LZ77-like compression algorithms. It defines the Node structure
+// for the Huffman tree, a priority queue for tree construction, and methods for creating and
+// managing Huffman codes.
+
+package lzhuff
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Node represents a node in the Huffman tree.
+// It can be either a leaf node containing a symbol or an internal node with child nodes.
+type Node struct {
+	value       int   // The symbol (only for leaf nodes).
+	freq        int   // Frequency of the symbol or combined frequency for internal nodes.
+	Left, Right *Node // Child nodes (nil for leaf nodes).
+	isLeaf      bool  // Indicates whether the node is a leaf.
+	id          int   // Unique identifier for graphviz representation.
+}
+
+// NewNode creates a new Node instance.
+// Parameters:
+// - id: Unique identifier for the node.
+// - val: Symbol (used only for leaf nodes).
+// - freq: Frequency of the symbol or combined frequency for internal nodes.
+// - l: Left child node (nil for leaf nodes).
+// - r: Right child node (nil for leaf nodes).
+func NewNode(id int, val int, freq int, l, r *Node) *Node {
+	return &Node{
+		id:     id,
+		value:  val,
+		freq:   freq,
+		Left:   l,
+		Right:  r,
+		isLeaf: l == nil && r == nil,
+	}
+}
+
+// DumpGraphviz writes the Graphviz representation of the Huffman tree to the provided writer.
+// It returns the first error encountered while writing.
+func (n *Node) DumpGraphviz(w io.Writer) error {
+	_, err := io.WriteString(w, "Digraph g {\n"+n.getGraphviz()+"}\n")
+	return err
+}
+
+// getGraphviz recursively generates the Graphviz representation of the Huffman tree.
+func (n *Node) getGraphviz() string {
+	repr := fmt.Sprintf("\t%d[label=\"value=%d freq=%d\"]\n", n.id, n.value, n.freq)
+	if n.Left != nil {
+		repr += fmt.Sprintf("\t%d -> %d[label=\"0\"]\n", n.id, n.Left.id)
+		repr += n.Left.getGraphviz()
+	}
+	if n.Right != nil {
+		repr += fmt.Sprintf("\t%d -> %d[label=\"1\"]\n", n.id, n.Right.id)
+		repr += n.Right.getGraphviz()
+	}
+	return repr
+}
+
+// PriorityQueue implements heap.Interface and holds Nodes.
+type PriorityQueue []*Node
+
+func (pq PriorityQueue) Len() int            { return len(pq) }
+func (pq PriorityQueue) Less(i, j int) bool  { return pq[i].freq < pq[j].freq }
+func (pq PriorityQueue) Swap(i, j int)       { pq[i], pq[j] = pq[j], pq[i] }
+func (pq *PriorityQueue) Push(x interface{}) { *pq = append(*pq, x.(*Node)) }
+func (pq *PriorityQueue) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	x := old[n-1]
+	*pq = old[0 : n-1]
+	return x
+}
+
+// RemoveEmpty removes nodes with zero frequency from the priority queue.
+func (pq *PriorityQueue) RemoveEmpty() PriorityQueue {
+	notEmptyPQ := make(PriorityQueue, 0, 256)
+	for _, node := range *pq {
+		if node.freq != 0 {
+			notEmptyPQ = append(notEmptyPQ, node)
+		}
+	}
+	return notEmptyPQ
+}
+
+// huffmanTrees holds the Huffman trees of the two alphabets of a block.
+// The tree of an alphabet without occurrences is nil.
+type huffmanTrees struct {
+	litLen    []*Node // Tree of the literal/length alphabet in every literal context.
+	distances *Node   // Tree of the distance alphabet.
+}
+
+// constructHuffmanTrees creates the Huffman trees based on the frequencies of the symbols of the
+// Values. The frequencies include the end-of-block marker that BinaryWriter appends to every
+// stream, so the tree of the literal/length alphabet is never empty without contexts.
+// Parameters:
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+func constructHuffmanTrees(values []Value, contexts []byte) huffmanTrees {
+	litLen, distances := symbolFrequencies(values, contexts)
+	trees := huffmanTrees{distances: buildHuffmanTree(distances)}
+	for _, freqs := range litLen {
+		trees.litLen = append(trees.litLen, buildHuffmanTree(freqs))
+	}
+	return trees
+}
+
+// DumpGraphviz writes the Graphviz representation of every non-empty tree to w.
+// It returns the first error encountered while writing.
+func (t huffmanTrees) DumpGraphviz(w io.Writer) error {
+	roots := append(append([]*Node{}, t.litLen...), t.distances)
+	for _, root := range roots {
+		if root == nil {
+			continue
+		}
+		if err := root.DumpGraphviz(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codeTables generates the code tables of the two alphabets from the trees.
+// Parameters:
+// - maxBits: The length of the longest code allowed.
+func (t huffmanTrees) codeTables(maxBits int) CodeTables {
+	cts := CodeTables{distances: createCodeTable(t.distances, distanceSymbols, maxBits)}
+	for _, root := range t.litLen {
+		cts.litLen = append(cts.litLen, createCodeTable(root, litLenSymbols, maxBits))
+	}
+	return cts
+}
+
+// buildHuffmanTree creates a Huffman tree over the symbols with a non-zero frequency.
+// Parameters:
+// - freqs: The frequency of every symbol, indexed by symbol.
+// Returns:
+// - The root node of the Huffman tree, or nil if every frequency is zero.
+func buildHuffmanTree(freqs []int) *Node {
+	nodes := make(PriorityQueue, len(freqs))
+	var idCounter int // Unique ID counter for nodes.
+
+	// Create a leaf for every symbol.
+	for i, freq := range freqs {
+		nodes[i] = &Node{
+			value:  i,
+			freq:   freq,
+			isLeaf: true,
+			id:     idCounter,
+		}
+		idCounter++
+	}
+
+	// Remove nodes with zero frequency.
+	nodes = nodes.RemoveEmpty()
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	// Initialize the heap.
+	heap.Init(&nodes)
+
+	// Build the Huffman tree.
+	for nodes.Len() > 1 {
+		// Pop two nodes with the smallest frequencies.
+		right := heap.Pop(&nodes).(*Node)
+		left := heap.Pop(&nodes).(*Node)
+
+		// Create a new internal node with these two nodes as children.
+		newNode := NewNode(idCounter, 0, left.freq+right.freq, left, right)
+		idCounter++
+
+		// Push the new node back into the heap.
+		heap.Push(&nodes, newNode)
+	}
+
+	// The remaining node is the root of the Huffman tree.
+	root := heap.Pop(&nodes).(*Node)
+	return root
+}
+
+// Code represents a binary code with its associated bit length.
+// The first bit of the code is the most significant of the low bits bits of c.
+type Code struct {
+	c    uint64 // The binary code value.
+	bits byte   // The number of bits in the code.
+}
+
+// String returns a string representation of the Code.
+func (c Code) String() string {
+	return fmt.Sprintf("%08b(%d)\n", c.c, c.bits)
+}
+
+// CodeTable holds the binary code of every symbol of an alphabet, indexed by symbol.
+// Symbols without a code have a Code of zero bits.
+// It is used by BinaryWriter to serialize data and by BinaryReader to deserialize data.
+type CodeTable []Code
+
+// CodeTables holds the code tables a block is encoded with, one per alphabet and, for the
+// literal/length alphabet, one per literal context.
+type CodeTables struct {
+	litLen    []CodeTable // Codes of the literal/length alphabet, indexed by literal context.
+	distances CodeTable   // Codes of the distance alphabet.
+}
+
+// createCodeTable generates a CodeTable from the Huffman tree.
+// The tree only determines the length of the code of every symbol; the codes themselves are
+// assigned canonically, so the table can be serialized as a list of code lengths.
+// Parameters:
+// - root: The root node of the Huffman tree, or nil for an alphabet without occurrences.
+// - symbols: The number of symbols of the alphabet.
+// - maxBits: The length of the longest code allowed.
+// Returns:
+// - A CodeTable mapping symbols to their binary codes.
+func createCodeTable(root *Node, symbols, maxBits int) CodeTable {
+	lengths := make([]byte, symbols)
+	if root != nil {
+		root.limitedCodeLengths(lengths, maxBits)
+	}
+	return canonicalCodes(lengths)
+}
+
+// limitedCodeLengths stores the code length of every leaf below n in lengths, indexed by the
+// leaf value, with no code longer than maxBits. The depths of the leaves are used when the tree
+// is shallow enough; otherwise the lengths are recomputed from the leaf frequencies with
+// packageMerge.
+// Parameters:
+// - lengths: The code lengths to fill.
+// - maxBits: The length of the longest code allowed; 1<<maxBits must not be below the number of leaves.
+func (n *Node) limitedCodeLengths(lengths []byte, maxBits int) {
+	n.codeLengths(0, lengths)
+	for _, l := range lengths {
+		if int(l) > maxBits {
+			freqs := make([]int, len(lengths))
+			n.leafFrequencies(freqs)
+			copy(lengths, packageMerge(freqs, maxBits))
+			return
+		}
+	}
+}
+
+// leafFrequencies stores the frequency of every leaf below n in freqs, indexed by the leaf value.
+func (n *Node) leafFrequencies(freqs []int) {
+	if n.isLeaf {
+		freqs[n.value] = n.freq
+		return
+	}
+	if n.Left != nil {
+		n.Left.leafFrequencies(freqs)
+	}
+	if n.Right != nil {
+		n.Right.leafFrequencies(freqs)
+	}
+}
+
+// pmItem is a coin of the package-merge algorithm: either a single symbol or a package of two
+// cheaper coins.
+type pmItem struct {
+	weight      int     // Total frequency of the symbols in the item.
+	symbol      int     // Symbol of a leaf item.
+	left, right *pmItem // Coins of a package; nil for a leaf item.
+}
+
+// packageMerge computes optimal code lengths for freqs under the constraint that no code is
+// longer than maxBits, using the package-merge algorithm of Larmore and Hirschberg.
+// Every symbol starts as a coin at every length from 1 to maxBits. Going from the longest length
+// to the shortest, the coins are paired into packages in order of weight and merged with the
+// coins of the next length; the 2n-2 cheapest items of the final list select the codes, and the
+// length of a symbol is the number of selected items containing it.
+// Parameters:
+// - freqs: The frequency of every symbol, indexed by symbol.
+// - maxBits: The length of the longest code allowed; 1<<maxBits must not be below the number
+// of symbols with a non-zero frequency.
+// Returns:
+// - The code length of every symbol, 0 for symbols with a zero frequency.
+func packageMerge(freqs []int, maxBits int) []byte {
+	lengths := make([]byte, len(freqs))
+	var leaves []*pmItem
+	for sym, freq := range freqs {
+		if freq > 0 {
+			leaves = append(leaves, &pmItem{weight: freq, symbol: sym})
+		}
+	}
+	if len(leaves) == 1 {
+		// A single symbol still needs a one-bit code so the reader can consume it.
+		lengths[leaves[0].symbol] = 1
+		return lengths
+	}
+	sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].weight < leaves[j].weight })
+
+	list := leaves
+	for level := 1; level < maxBits; level++ {
+		// Package adjacent pairs of the current list; an odd coin out is dropped.
+		packages := make([]*pmItem, 0, len(list)/2)
+		for i := 0; i+1 < len(list); i += 2 {
+			packages = append(packages, &pmItem{weight: list[i].weight + list[i+1].weight, left: list[i], right: list[i+1]})
+		}
+
+		// Merge the packages with a fresh set of leaves, keeping the list sorted by weight.
+		merged := make([]*pmItem, 0, len(leaves)+len(packages))
+		i, j := 0, 0
+		for i < len(leaves) || j < len(packages) {
+			if j == len(packages) || i < len(leaves) && leaves[i].weight <= packages[j].weight {
+				merged = append(merged, leaves[i])
+				i++
+			} else {
+				merged = append(merged, packages[j])
+				j++
+			}
+		}
+		list = merged
+	}
+
+	var count func(item *pmItem)
+	count = func(item *pmItem) {
+		if item.left == nil {
+			lengths[item.symbol]++
+			return
+		}
+		count(item.left)
+		count(item.right)
+	}
+	for _, item := range list[:2*len(leaves)-2] {
+		count(item)
+	}
+	return lengths
+}
+
+// lengths returns the code length of every symbol, 0 for symbols without a code.
+func (ct CodeTable) lengths() []byte {
+	lengths := make([]byte, len(ct))
+	for sym, code := range ct {
+		lengths[sym] = code.bits
+	}
+	return lengths
+}
+
+// tableBits returns the size in bits of the serialized form of ct written by BinaryWriter.
+func (ct CodeTable) tableBits() int {
+	return newLengthTable(ct.lengths()).bits()
+}
+
+// tableBits returns the size in bits of the serialized form of all tables.
+func (cts CodeTables) tableBits() int {
+	bits := cts.distances.tableBits()
+	for _, table := range cts.litLen {
+		bits += table.tableBits()
+	}
+	return bits
+}
+
+// valueBits returns the number of bits BinaryWriter spends on v.
+// Parameters:
+// - v: The Value.
+// - ctx: The literal context of v.
+// - reps: The recent distances before v, updated with the distance of v.
+// Returns:
+// - The number of bits.
+// - Whether every symbol of v has a code.
+func (cts CodeTables) valueBits(v Value, ctx int, reps *repDistances) (int, bool) {
+	litLen := cts.litLen[ctx]
+	if v.IsLiteral {
+		code := litLen[v.val]
+		return int(code.bits), code.bits != 0
+	}
+	if v.isEndOfBlock() {
+		code := litLen[litLenEOB]
+		return int(code.bits), code.bits != 0
+	}
+
+	lsym, _, lextra := lengthSymbol(int(v.length))
+	dsym, _, dextra := reps.encode(int(v.distance))
+	lcode, dcode := litLen[lsym], cts.distances[dsym]
+	bits := int(lcode.bits) + int(lextra) + int(dcode.bits) + int(dextra)
+	return bits, lcode.bits != 0 && dcode.bits != 0
+}
+
+// encodedBits returns the number of bits BinaryWriter spends on values and the end-of-block
+// marker when they are encoded with cts, excluding the tables themselves.
+// Parameters:
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+// Returns:
+// - The number of bits.
+// - Whether every symbol of values has a code in cts.
+func (cts CodeTables) encodedBits(values []Value, contexts []byte) (int, bool) {
+	reps := newRepDistances()
+	total, ok := cts.valueBits(endOfBlock, contextOf(contexts, len(values)), &reps)
+	for i := 0; ok && i < len(values); i++ {
+		var bits int
+		bits, ok = cts.valueBits(values[i], contextOf(contexts, i), &reps)
+		total += bits
+	}
+	if !ok {
+		return 0, false
+	}
+	return total, true
+}
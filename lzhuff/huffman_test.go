@@ -0,0 +1,116 @@
+// huffman_test.go
+// Package lzhuff contains tests for the construction of Huffman codes.
+// These tests verify that code lengths stay within the configured limit on adversarial
+// frequencies and that limiting the lengths costs as little as possible.
+
+package lzhuff
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// fibonacciFrequencies returns n frequencies following the Fibonacci sequence, which make the
+// unlimited Huffman tree as deep as possible: n-1 levels.
+func fibonacciFrequencies(n int) []int {
+	freqs := make([]int, n)
+	a, b := 1, 1
+	for i := range freqs {
+		freqs[i] = a
+		a, b = b, a+b
+	}
+	return freqs
+}
+
+// codeCost returns the number of bits spent on a message with freqs when coded with lengths.
+func codeCost(freqs []int, lengths []byte) int {
+	cost := 0
+	for sym, freq := range freqs {
+		cost += freq * int(lengths[sym])
+	}
+	return cost
+}
+
+// Test_packageMerge tests that package-merge respects the length limit, produces complete codes,
+// and matches the unlimited Huffman code when the limit is not binding.
+func Test_packageMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		freqs   []int
+		maxBits int
+	}{
+		{name: "Fibonacci, 40 symbols, 15 bits", freqs: fibonacciFrequencies(40), maxBits: 15},
+		{name: "Fibonacci, 40 symbols, 8 bits", freqs: fibonacciFrequencies(40), maxBits: 8},
+		{name: "Fibonacci, 64 symbols, 6 bits", freqs: fibonacciFrequencies(64), maxBits: 6},
+		{name: "Fibonacci, 20 symbols, no limit", freqs: fibonacciFrequencies(20), maxBits: 19},
+		{name: "Two symbols, 1 bit", freqs: []int{5, 1}, maxBits: 1},
+		{name: "Sparse", freqs: []int{0, 7, 0, 0, 1, 1, 0, 1, 2}, maxBits: 3},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			lengths := packageMerge(tt.freqs, tt.maxBits)
+			kraft := 0.0
+			for sym, l := range lengths {
+				if (l == 0) != (tt.freqs[sym] == 0) {
+					t.Fatalf("symbol %d with frequency %d has a %d-bit code", sym, tt.freqs[sym], l)
+				}
+				if int(l) > tt.maxBits {
+					t.Fatalf("symbol %d has a %d-bit code; limit is %d", sym, l, tt.maxBits)
+				}
+				if l != 0 {
+					kraft += 1 / float64(uint64(1)<<l)
+				}
+			}
+			if kraft != 1 {
+				t.Errorf("Kraft sum = %v; want a complete code", kraft)
+			}
+
+			unlimited := make([]byte, len(tt.freqs))
+			buildHuffmanTree(tt.freqs).codeLengths(0, unlimited)
+			limitedCost, huffmanCost := codeCost(tt.freqs, lengths), codeCost(tt.freqs, unlimited)
+			if limitedCost < huffmanCost {
+				t.Errorf("limited code costs %d bits, less than the optimal %d bits", limitedCost, huffmanCost)
+			}
+			depth := 0
+			for _, l := range unlimited {
+				depth = max(depth, int(l))
+			}
+			if depth <= tt.maxBits && limitedCost != huffmanCost {
+				t.Errorf("limit is not binding, but the limited code costs %d bits; Huffman costs %d bits", limitedCost, huffmanCost)
+			}
+		})
+	}
+}
+
+// Test_MaxCodeBits tests that input with Fibonacci-distributed bytes round-trips with its codes
+// limited to a few bits.
+func Test_MaxCodeBits(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	var input []byte
+	for sym, freq := range fibonacciFrequencies(24) {
+		input = append(input, bytes.Repeat([]byte{byte(sym)}, freq)...)
+	}
+	rng.Shuffle(len(input), func(i, j int) { input[i], input[j] = input[j], input[i] })
+
+	cfg, err := newConfig(defaultConfig(), nil)
+	if err != nil {
+		t.Fatalf("newConfig() error = %v", err)
+	}
+	trees := constructHuffmanTrees(parseValues(input, 0, cfg.lzParams()), nil)
+	for _, code := range createCodeTable(trees.litLen[0], litLenSymbols, minCodeBits) {
+		if code.bits > minCodeBits {
+			t.Fatalf("createCodeTable() returned a %d-bit code; limit is %d", code.bits, minCodeBits)
+		}
+	}
+
+	for _, maxBits := range []int{minCodeBits, DefaultMaxCodeBits, maxCodeBits} {
+		if got := roundTrip(t, input, WithLevel(MinLevel), WithMaxCodeBits(maxBits)); !bytes.Equal(got, input) {
+			t.Errorf("%d-bit codes: round trip does not restore the input", maxBits)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// inflate.go
+// Package lzhuff provides DeflateReader, a decoder of raw DEFLATE streams (RFC 1951) built on the
+// bit reader and the table-driven Huffman decoder of this package. It decodes stored blocks,
+// blocks coded with the fixed Huffman codes and blocks coded with dynamic Huffman codes, from any
+// encoder. A DEFLATE block may decode to any length, so blocks are decoded in chunks as Read needs
+// them, and only the chunk and the 32 KiB window preceding it are kept in memory.
+
+package lzhuff
+
+import (
+	"fmt"
+	"io"
+)
+
+// inflateChunk is the number of bytes decoded at a time, unless a block ends before.
+const inflateChunk = 1 << 16
+
+// inflateFixedDecoders decode the fixed Huffman codes of RFC 1951 section 3.2.6.
+var inflateFixedDecoders = struct {
+	litLen, distances huffmanDecoder
+}{
+	litLen:    newHuffmanDecoder(deflateFixedCodes.litLen.lengths()),
+	distances: newHuffmanDecoder(deflateFixedCodes.distances.lengths()),
+}
+
+// DeflateReader is an io.Reader that decompresses a raw DEFLATE stream read from an underlying
+// io.Reader, such as the streams written by DeflateWriter or compress/flate.
+type DeflateReader struct {
+	r         *bitReader     // Bit-level reader over the compressed stream.
+	window    []byte         // Search window followed by the bytes of the current chunk.
+	out       []byte         // Decompressed bytes of the current chunk not yet returned to the caller.
+	inBlock   bool           // Whether a block has been started and not ended yet.
+	final     bool           // Whether the current block is the final block of the stream.
+	stored    int            // Number of bytes of the current stored block left, or -1 for a coded block.
+	litLen    huffmanDecoder // Decoder of the literal/length symbols of the current coded block.
+	distances huffmanDecoder // Decoder of the distance symbols of the current coded block.
+	done      bool           // Whether the final block has been decoded.
+	err       error          // Error encountered while decoding, returned by every later Read.
+}
+
+// NewDeflateReader returns a new DeflateReader decompressing data from r.
+// The stream ends after its final block, but DeflateReader reads ahead of the bits it decodes: up
+// to 8 bytes past the end of the stream may be consumed from r, and more when r is not an
+// io.ByteReader and gets buffered. Data following the stream cannot be read from r afterwards.
+func NewDeflateReader(r io.Reader) *DeflateReader {
+	return newDeflateReader(newLSBBitReader(r))
+}
+
+// newDeflateReader returns a DeflateReader decoding the stream at the position of r, which reads
+// in the bit order of DEFLATE. The container readers share r with it.
+func newDeflateReader(r *bitReader) *DeflateReader {
+	return &DeflateReader{r: r}
+}
+
+// Read reads decompressed data into p. It implements io.Reader.
+// Errors encountered while decoding wrap one of the package's sentinel errors.
+func (z *DeflateReader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		if z.done {
+			return 0, io.EOF
+		}
+		z.err = z.decodeChunk()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+// decodeChunk decodes up to inflateChunk bytes, or more by the length of a match, into the window
+// and points z.out at them. It stops early when the final block ends.
+func (z *DeflateReader) decodeChunk() error {
+	// Drop the history no pointer can reach anymore.
+	if len(z.window) > deflateWindow {
+		z.window = z.window[:copy(z.window, z.window[len(z.window)-deflateWindow:])]
+	}
+	start := len(z.window)
+	for len(z.window)-start < inflateChunk && !z.done {
+		var err error
+		switch {
+		case !z.inBlock:
+			err = z.readBlockHeader()
+		case z.stored >= 0:
+			err = z.readStored(start + inflateChunk - len(z.window))
+		default:
+			err = z.decodeSymbols(start + inflateChunk)
+		}
+		if err != nil {
+			return err
+		}
+		if !z.inBlock && z.final {
+			z.done = true
+		}
+	}
+	z.out = z.window[start:]
+	return nil
+}
+
+// readBlockHeader reads the header of the next block and, for a coded block, its codes.
+func (z *DeflateReader) readBlockHeader() error {
+	header, err := z.r.readLSB(3)
+	if err != nil {
+		return fmt.Errorf("DeflateReader.readBlockHeader: %w", truncated(err))
+	}
+	z.inBlock, z.final, z.stored = true, header&1 == 1, -1
+	switch header >> 1 {
+	case deflateStored:
+		z.r.Align()
+		lengths, err := z.r.readLSB(32)
+		if err != nil {
+			return fmt.Errorf("DeflateReader.readBlockHeader: reading stored length: %w", truncated(err))
+		}
+		length, nlength := lengths&0xffff, lengths>>16
+		if length != ^nlength&0xffff {
+			return fmt.Errorf("DeflateReader.readBlockHeader: stored length %d does not match its complement %d: %w", length, nlength, ErrCorruptStream)
+		}
+		z.stored = int(length)
+	case deflateFixed:
+		z.litLen, z.distances = inflateFixedDecoders.litLen, inflateFixedDecoders.distances
+	case deflateDynamic:
+		z.litLen, z.distances, err = readDeflateCodes(z.r)
+		return err
+	default:
+		return fmt.Errorf("DeflateReader.readBlockHeader: reserved block type: %w", ErrCorruptStream)
+	}
+	return nil
+}
+
+// readStored copies up to limit bytes of the current stored block into the window.
+func (z *DeflateReader) readStored(limit int) error {
+	n := min(z.stored, limit)
+	start := len(z.window)
+	z.window = append(z.window, make([]byte, n)...)
+	if _, err := io.ReadFull(z.r, z.window[start:]); err != nil {
+		return fmt.Errorf("DeflateReader.readStored: %w", truncated(err))
+	}
+	z.stored -= n
+	z.inBlock = z.stored > 0
+	return nil
+}
+
+// decodeSymbols decodes symbols of the current coded block into the window until the window
+// holds at least limit bytes or the block ends.
+func (z *DeflateReader) decodeSymbols(limit int) error {
+	for len(z.window) < limit {
+		sym, err := z.litLen.decode(z.r)
+		if err != nil {
+			return fmt.Errorf("DeflateReader.decodeSymbols: %w", truncated(err))
+		}
+		switch {
+		case sym < deflateEOB:
+			z.window = append(z.window, byte(sym))
+			continue
+		case sym == deflateEOB:
+			z.inBlock = false
+			return nil
+		case sym >= deflateLitLenSyms:
+			return fmt.Errorf("DeflateReader.decodeSymbols: invalid length symbol %d: %w", sym, ErrCorruptStream)
+		}
+
+		length := deflateMaxMatch
+		if sym != deflateMaxLengthSym {
+			if length, err = z.readExtra(deflateLengthCode, sym-deflateEOB-1); err != nil {
+				return err
+			}
+		}
+		if sym, err = z.distances.decode(z.r); err != nil {
+			return fmt.Errorf("DeflateReader.decodeSymbols: %w", truncated(err))
+		}
+		if sym >= deflateDistanceSyms {
+			return fmt.Errorf("DeflateReader.decodeSymbols: invalid distance symbol %d: %w", sym, ErrCorruptStream)
+		}
+		distance, err := z.readExtra(distanceCode, sym)
+		if err != nil {
+			return err
+		}
+		if distance > len(z.window) {
+			return fmt.Errorf("DeflateReader.decodeSymbols: distance %d with %d bytes of window: %w", distance, len(z.window), ErrInvalidDistance)
+		}
+		z.window = appendMatch(z.window, distance, length)
+	}
+	return nil
+}
+
+// readExtra reads the extra bits following sym and returns the value they identify within the
+// bucket of sym.
+func (z *DeflateReader) readExtra(c extraCode, sym int) (int, error) {
+	base, extraBits := c.bucket(sym)
+	extra, err := z.r.readLSB(extraBits)
+	if err != nil {
+		return 0, fmt.Errorf("DeflateReader.readExtra: %w", truncated(err))
+	}
+	return base + int(extra), nil
+}
+
+// readDeflateCodes reads the table of a dynamic block and builds the decoders of its codes.
+// Returns:
+// - The decoders of the literal/length and distance codes.
+// - An error wrapping ErrCorruptTable or ErrTruncatedStream if the table cannot be read.
+func readDeflateCodes(r *bitReader) (huffmanDecoder, huffmanDecoder, error) {
+	counts, err := r.readLSB(14)
+	if err != nil {
+		return huffmanDecoder{}, huffmanDecoder{}, fmt.Errorf("readDeflateCodes: reading counts: %w", truncated(err))
+	}
+	nLitLen := int(counts&0x1f) + deflateEOB + 1
+	nDistance := int(counts>>5&0x1f) + 1
+	nCL := int(counts>>10) + clMinCount
+	if nLitLen > deflateLitLenSyms || nDistance > deflateDistanceSyms {
+		return huffmanDecoder{}, huffmanDecoder{}, fmt.Errorf("readDeflateCodes: %d literal/length and %d distance codes: %w", nLitLen, nDistance, ErrCorruptTable)
+	}
+
+	clLengths := make([]byte, deflateCLSyms)
+	for _, sym := range clOrder[:nCL] {
+		l, err := r.readLSB(3)
+		if err != nil {
+			return huffmanDecoder{}, huffmanDecoder{}, fmt.Errorf("readDeflateCodes: reading code-length code: %w", truncated(err))
+		}
+		clLengths[sym] = byte(l)
+	}
+	if err := checkCodeLengths(clLengths); err != nil {
+		return huffmanDecoder{}, huffmanDecoder{}, err
+	}
+	clDecoder := newHuffmanDecoder(clLengths)
+
+	// The code lengths of both alphabets are run-length encoded as one list.
+	lengths := make([]byte, 0, nLitLen+nDistance)
+	for len(lengths) < nLitLen+nDistance {
+		sym, err := clDecoder.decode(r)
+		if err != nil {
+			return huffmanDecoder{}, huffmanDecoder{}, fmt.Errorf("readDeflateCodes: %w", truncated(err))
+		}
+		if sym < clRepeat {
+			lengths = append(lengths, byte(sym))
+			continue
+		}
+		extra, err := r.readLSB(clExtraBits[sym])
+		if err != nil {
+			return huffmanDecoder{}, huffmanDecoder{}, fmt.Errorf("readDeflateCodes: reading extra bits: %w", truncated(err))
+		}
+		var l byte
+		var run int
+		switch sym {
+		case clRepeat:
+			if len(lengths) == 0 {
+				return huffmanDecoder{}, huffmanDecoder{}, fmt.Errorf("readDeflateCodes: repeat without a previous length: %w", ErrCorruptTable)
+			}
+			l, run = lengths[len(lengths)-1], 3+int(extra)
+		case clZeros:
+			run = 3 + int(extra)
+		default:
+			run = 11 + int(extra)
+		}
+		if len(lengths)+run > nLitLen+nDistance {
+			return huffmanDecoder{}, huffmanDecoder{}, fmt.Errorf("readDeflateCodes: run of %d overflows the table: %w", run, ErrCorruptTable)
+		}
+		for i := 0; i < run; i++ {
+			lengths = append(lengths, l)
+		}
+	}
+
+	litLen, distances := lengths[:nLitLen], lengths[nLitLen:]
+	if litLen[deflateEOB] == 0 {
+		return huffmanDecoder{}, huffmanDecoder{}, fmt.Errorf("readDeflateCodes: no code for the end of the block: %w", ErrCorruptTable)
+	}
+	for _, l := range [][]byte{litLen, distances} {
+		if err := checkCodeLengths(l); err != nil {
+			return huffmanDecoder{}, huffmanDecoder{}, err
+		}
+	}
+	return newHuffmanDecoder(litLen), newHuffmanDecoder(distances), nil
+}
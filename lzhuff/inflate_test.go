@@ -0,0 +1,138 @@
+// inflate_test.go
+// Package lzhuff contains tests for the DEFLATE decoder.
+// These tests verify that DeflateReader decodes the stored, fixed and dynamic blocks written by
+// compress/flate and by DeflateWriter, across chunk boundaries and with reads of any size, and
+// that malformed streams are rejected with the matching sentinel error.
+
+package lzhuff
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// Test_DeflateReader tests that DeflateReader restores the input compressed by compress/flate at
+// every level and by DeflateWriter.
+func Test_DeflateReader(t *testing.T) {
+	corpus := testCorpus()
+	corpus["Empty"] = nil
+	corpus["Several chunks"] = bytes.Repeat(corpus["Words"], 10)
+
+	flateLevels := []int{flate.NoCompression, flate.BestSpeed, flate.DefaultCompression, flate.BestCompression, flate.HuffmanOnly}
+	for name, input := range corpus {
+		input := input // Capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			var streams [][]byte
+			for _, level := range flateLevels {
+				var compressed bytes.Buffer
+				fw, err := flate.NewWriter(&compressed, level)
+				if err != nil {
+					t.Fatalf("flate.NewWriter() error = %v", err)
+				}
+				fw.Write(input)
+				fw.Close()
+				streams = append(streams, compressed.Bytes())
+			}
+			streams = append(streams, deflate(t, input), deflate(t, input, WithBlockSize(5000), WithLevel(MaxLevel)))
+
+			for i, compressed := range streams {
+				got, err := io.ReadAll(NewDeflateReader(bytes.NewReader(compressed)))
+				if err != nil {
+					t.Fatalf("stream %d: DeflateReader.Read() error = %v", i, err)
+				}
+				if !bytes.Equal(got, input) {
+					t.Errorf("stream %d: DeflateReader does not restore the input", i)
+				}
+			}
+
+			// Reads of a single byte, from a source serving a single byte at a time.
+			got, err := io.ReadAll(iotest.OneByteReader(NewDeflateReader(iotest.OneByteReader(bytes.NewReader(streams[2])))))
+			if err != nil {
+				t.Fatalf("one-byte reads: DeflateReader.Read() error = %v", err)
+			}
+			if !bytes.Equal(got, input) {
+				t.Errorf("one-byte reads: DeflateReader does not restore the input")
+			}
+		})
+	}
+}
+
+// Test_DeflateReaderCorrupt tests that malformed streams fail with the matching sentinel error.
+func Test_DeflateReaderCorrupt(t *testing.T) {
+	valid := deflate(t, testCorpus()["Words"])
+
+	// stream returns the bytes written by write.
+	stream := func(write func(w *lsbWriter)) []byte {
+		var w lsbWriter
+		write(&w)
+		w.align()
+		return w.out
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{name: "Truncated", input: valid[:len(valid)/2], wantErr: ErrTruncatedStream},
+		{name: "Empty", input: nil, wantErr: ErrTruncatedStream},
+		{name: "Reserved block type", input: stream(func(w *lsbWriter) {
+			w.writeBits(1|3<<1, 3)
+		}), wantErr: ErrCorruptStream},
+		{name: "Stored length mismatch", input: stream(func(w *lsbWriter) {
+			w.writeBits(1|deflateStored<<1, 3)
+			w.align()
+			w.writeBits(5, 16)
+			w.writeBits(5, 16)
+		}), wantErr: ErrCorruptStream},
+		{name: "Distance before the start", input: stream(func(w *lsbWriter) {
+			w.writeBits(1|deflateFixed<<1, 3)
+			w.writeCode(deflateFixedCodes.litLen['a'])
+			sym, _, _ := deflateLengthSymbol(3)
+			w.writeCode(deflateFixedCodes.litLen[sym])
+			w.writeCode(deflateFixedCodes.distances[2])
+		}), wantErr: ErrInvalidDistance},
+		{name: "Invalid distance symbol", input: stream(func(w *lsbWriter) {
+			w.writeBits(1|deflateFixed<<1, 3)
+			w.writeCode(deflateFixedCodes.litLen['a'])
+			sym, _, _ := deflateLengthSymbol(3)
+			w.writeCode(deflateFixedCodes.litLen[sym])
+			w.writeCode(deflateFixedCodes.distances[deflateDistanceSyms])
+		}), wantErr: ErrCorruptStream},
+		{name: "Too many length codes", input: stream(func(w *lsbWriter) {
+			w.writeBits(1|deflateDynamic<<1, 3)
+			w.writeBits(31, 5)
+			w.writeBits(0, 9)
+		}), wantErr: ErrCorruptTable},
+		{name: "Repeat without length", input: stream(func(w *lsbWriter) {
+			w.writeBits(1|deflateDynamic<<1, 3)
+			w.writeBits(0, 5)
+			w.writeBits(0, 5)
+			w.writeBits(0, 4)
+			// Code-length code: one-bit codes for clRepeat and clZerosLong.
+			w.writeBits(1, 3)
+			w.writeBits(0, 3)
+			w.writeBits(1, 3)
+			w.writeBits(0, 3)
+			w.writeBits(0, 1)
+		}), wantErr: ErrCorruptTable},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			_, err := io.ReadAll(NewDeflateReader(bytes.NewReader(tt.input)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeflateReader.Read() error = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
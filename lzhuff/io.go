@@ -0,0 +1,399 @@
+// io.go
+// Package lzhuff provides functionality for writing and reading compressed data using a binary format.
+// It defines BinaryWriter and BinaryReader types that handle the serialization and deserialization
+// of Value slices based on the CodeTables of a block. The package leverages bit-level IO operations
+// to efficiently encode literals and pointers as part of an LZ77-like compression algorithm.
+
+package lzhuff
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/icza/bitio"
+)
+
+// BinaryWriter is responsible for serializing Value slices into a binary format.
+// It utilizes CodeTables to encode literals and pointers efficiently.
+type BinaryWriter struct {
+	w        *bitio.Writer // Bit-level writer for output operations.
+	codes    CodeTables    // Codes of the literal/length and distance symbols.
+	contexts []byte        // Literal context of every Value and of the marker, or nil.
+}
+
+// NewBinaryWriter creates and returns a new BinaryWriter.
+// Parameters:
+// - writer: An io.Writer where the binary data will be written.
+// - codes: The CodeTables that define the encoding scheme for literals and pointers.
+func NewBinaryWriter(writer io.Writer, codes CodeTables) BinaryWriter {
+	bitWriter := bitio.NewWriter(writer)
+	return BinaryWriter{
+		w:     bitWriter,
+		codes: codes,
+	}
+}
+
+// Write serializes a slice of Value instances into binary format.
+// It writes the code tables first, followed by each Value's data and the end-of-block marker.
+// Parameters:
+// - values: A slice of Value instances to be serialized.
+// Returns:
+// - An error if a code table is invalid, a value has no code, or writing fails.
+func (bw *BinaryWriter) Write(values []Value) error {
+	// Write the code tables to the binary stream.
+	for _, table := range append(append([]CodeTable{}, bw.codes.litLen...), bw.codes.distances) {
+		if err := bw.writeTable(table); err != nil {
+			return err
+		}
+	}
+	return bw.writeValues(values)
+}
+
+// writeValues serializes a slice of Value instances without the code tables, for a block that
+// reuses the tables of the previous block. The end-of-block marker is written after the values.
+// Parameters:
+// - values: A slice of Value instances to be serialized.
+func (bw *BinaryWriter) writeValues(values []Value) error {
+	// Iterate over each Value and serialize it.
+	reps := newRepDistances()
+	for i, v := range values {
+		if err := bw.writeValue(v, contextOf(bw.contexts, i), &reps); err != nil {
+			return err
+		}
+	}
+
+	// Terminate the stream so the padding bits of the last byte are never decoded.
+	if err := bw.writeValue(endOfBlock, contextOf(bw.contexts, len(values)), &reps); err != nil {
+		return err
+	}
+
+	// Close the bit writer to flush any remaining bits.
+	if err := bw.w.Close(); err != nil {
+		return fmt.Errorf("BinaryWriter.writeValues: closing bit writer: %w", err)
+	}
+	return nil
+}
+
+// writeValue serializes a single Value: the literal/length symbol of the literal or of the
+// end-of-block marker, or the codes and extra bits of the length and distance of the pointer.
+// Parameters:
+// - v: The Value to serialize.
+// - ctx: The literal context of v, which selects the literal/length code.
+// - reps: The recent distances before v, updated with the distance of v.
+func (bw *BinaryWriter) writeValue(v Value, ctx int, reps *repDistances) error {
+	litLen := bw.codes.litLen[ctx]
+	if v.IsLiteral {
+		return bw.writeSymbol(litLen, int(v.val), 0, 0)
+	}
+	if v.isEndOfBlock() {
+		return bw.writeSymbol(litLen, litLenEOB, 0, 0)
+	}
+
+	// For pointers, write the length and the distance, each as a symbol and extra bits.
+	sym, extra, extraBits := lengthSymbol(int(v.length))
+	if err := bw.writeSymbol(litLen, sym, extra, extraBits); err != nil {
+		return err
+	}
+	sym, extra, extraBits = reps.encode(int(v.distance))
+	return bw.writeSymbol(bw.codes.distances, sym, extra, extraBits)
+}
+
+// writeSymbol writes the code of sym followed by extraBits bits of extra.
+// Parameters:
+// - table: The code table of the alphabet of sym.
+// - sym: The symbol to write.
+// - extra: The extra bits following the code.
+// - extraBits: The number of extra bits.
+// Returns:
+// - An error wrapping ErrUnknownCode if sym has no code in table, or the error of the writer.
+func (bw *BinaryWriter) writeSymbol(table CodeTable, sym int, extra uint64, extraBits byte) error {
+	code := table[sym]
+	if code.bits == 0 {
+		return fmt.Errorf("BinaryWriter.writeSymbol: no code for symbol %d: %w", sym, ErrUnknownCode)
+	}
+	if err := bw.w.WriteBits(code.c, code.bits); err != nil {
+		return fmt.Errorf("BinaryWriter.writeSymbol: writing code bits: %w", err)
+	}
+	if extraBits > 0 {
+		if err := bw.w.WriteBits(extra, extraBits); err != nil {
+			return fmt.Errorf("BinaryWriter.writeSymbol: writing extra bits: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeTable serializes a CodeTable into the binary stream.
+// Codes are canonical, so only the code length of every symbol is written.
+// Parameters:
+// - table: The CodeTable to serialize.
+// Returns:
+// - An error if the table cannot be represented or writing fails.
+func (bw *BinaryWriter) writeTable(table CodeTable) error {
+	lengths := table.lengths()
+	if err := checkCodeLengths(lengths); err != nil {
+		return fmt.Errorf("BinaryWriter.writeTable: %w", err)
+	}
+	return newLengthTable(lengths).write(bw.w)
+}
+
+// BinaryReader is responsible for deserializing binary data into Value slices.
+// It reads the code tables first, then reconstructs each Value based on the serialized data.
+type BinaryReader struct {
+	r         *bitReader       // Bit-level reader for input operations.
+	litLen    []huffmanDecoder // Decoders of the literal/length alphabet, indexed by literal context.
+	distances huffmanDecoder   // Decoder of the distance alphabet.
+	hasTables bool             // Whether code tables have been read.
+}
+
+// NewBinaryReader creates and returns a new BinaryReader.
+// Parameters:
+// - reader: An io.Reader from which the binary data will be read.
+func NewBinaryReader(reader io.Reader) BinaryReader {
+	return BinaryReader{
+		r: newBitReader(reader),
+	}
+}
+
+// Read deserializes binary data into a slice of Value instances.
+// It first reads the code tables, then iterates through the binary stream to reconstruct each Value
+// until the end-of-block marker is found. The marker itself is not included in the result.
+// Returns:
+// - A slice of Value instances representing the decompressed data.
+// - An error if a code table or the value stream is malformed or truncated.
+func (br *BinaryReader) Read() ([]Value, error) {
+	if err := br.readTables(1); err != nil {
+		return nil, err
+	}
+	return br.readValues()
+}
+
+// readTables deserializes the code tables of a block, which replace the tables read last.
+// Parameters:
+// - contexts: The number of literal/length tables, 1 without literal contexts.
+// Returns:
+// - An error wrapping ErrCorruptTable or ErrTruncatedStream if a table cannot be read.
+func (br *BinaryReader) readTables(contexts int) error {
+	br.hasTables = false
+	br.litLen = make([]huffmanDecoder, contexts)
+	for ctx := range br.litLen {
+		decoder, err := br.readTable(litLenSymbols)
+		if err != nil {
+			return err
+		}
+		br.litLen[ctx] = decoder
+	}
+	decoder, err := br.readTable(distanceSymbols)
+	if err != nil {
+		return err
+	}
+	br.distances = decoder
+	br.hasTables = true
+	return nil
+}
+
+// readValues deserializes Value instances with the code tables read last, for a block that
+// reuses the tables of the previous block. It stops at the end-of-block marker.
+// Returns:
+// - A slice of Value instances representing the decompressed data.
+// - An error wrapping ErrCorruptTable if no tables have been read yet, or an error if the value
+// stream is malformed or truncated.
+func (br *BinaryReader) readValues() ([]Value, error) {
+	if !br.hasTables || len(br.litLen) != 1 {
+		return nil, fmt.Errorf("BinaryReader.readValues: no previous code table: %w", ErrCorruptTable)
+	}
+
+	// Initialize a slice to hold the reconstructed Values.
+	values := make([]Value, 0)
+
+	// Continuously consume Values until the end-of-block marker is reached.
+	reps := newRepDistances()
+	for {
+		val, err := br.consumeValue(&reps)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.readValues: value %d: %w", len(values), err)
+		}
+		if val.isEndOfBlock() {
+			break
+		}
+		values = append(values, val)
+	}
+
+	return values, nil
+}
+
+// decodeBlock decodes the values of a block with the code tables read last and appends the bytes
+// they stand for to window, resolving every pointer against the bytes already in window. With
+// literal contexts, the last byte of window selects the literal/length table of every symbol. No
+// Value is materialized, and it stops at the end-of-block marker.
+// Parameters:
+// - window: The search window preceding the block.
+// - limit: The number of bytes the block may decode to.
+// Returns:
+// - window extended with the bytes of the block.
+// - An error wrapping ErrCorruptTable if no tables have been read yet, ErrInvalidDistance if a
+// pointer reaches before the window, ErrSizeMismatch if the block exceeds limit, or an error if
+// the value stream is malformed or truncated.
+func (br *BinaryReader) decodeBlock(window []byte, limit int) ([]byte, error) {
+	if !br.hasTables {
+		return nil, fmt.Errorf("BinaryReader.decodeBlock: no previous code table: %w", ErrCorruptTable)
+	}
+
+	end := len(window) + limit
+	reps := newRepDistances()
+	for {
+		litLen := &br.litLen[0]
+		if len(br.litLen) > 1 {
+			litLen = &br.litLen[windowContext(window)]
+		}
+		sym, err := br.readSymbol(litLen)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeBlock: %w", truncated(err))
+		}
+		if sym == litLenEOB {
+			return window, nil
+		}
+		if len(window) == end {
+			return nil, fmt.Errorf("BinaryReader.decodeBlock: block exceeds %d bytes: %w", limit, ErrSizeMismatch)
+		}
+		if sym < litLenEOB {
+			window = append(window, byte(sym))
+			continue
+		}
+
+		length, err := br.readExtra(lengthCode, sym-litLenEOB-1)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeBlock: %w", truncated(err))
+		}
+		sym, err = br.readSymbol(&br.distances)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeBlock: %w", truncated(err))
+		}
+		distance, err := br.readDistance(sym, &reps)
+		if err != nil {
+			return nil, fmt.Errorf("BinaryReader.decodeBlock: %w", truncated(err))
+		}
+		if distance > len(window) {
+			return nil, fmt.Errorf("BinaryReader.decodeBlock: distance %d with %d bytes of output: %w", distance, len(window), ErrInvalidDistance)
+		}
+		if length > end-len(window) {
+			return nil, fmt.Errorf("BinaryReader.decodeBlock: block exceeds %d bytes: %w", limit, ErrSizeMismatch)
+		}
+		window = appendMatch(window, distance, length)
+	}
+}
+
+// readAligned skips the padding bits of the current byte and reads len(p) bytes that follow
+// the bit stream, such as the stream trailer.
+// Parameters:
+// - p: The buffer to fill.
+func (br *BinaryReader) readAligned(p []byte) error {
+	br.r.Align()
+	if _, err := io.ReadFull(br.r, p); err != nil {
+		return fmt.Errorf("BinaryReader.readAligned: %w", truncated(err))
+	}
+	return nil
+}
+
+// readTable deserializes a CodeTable from the binary stream.
+// It reads the code length of every symbol and assigns the canonical codes.
+// Parameters:
+// - symbols: The number of symbols of the alphabet.
+// Returns:
+// - The decoder of the alphabet.
+// - An error wrapping ErrCorruptTable or ErrTruncatedStream if the table cannot be read.
+func (br *BinaryReader) readTable(symbols int) (huffmanDecoder, error) {
+	lengths, err := readCodeLengths(br.r, symbols)
+	if err != nil {
+		return huffmanDecoder{}, fmt.Errorf("BinaryReader.readTable: %w", err)
+	}
+	return newHuffmanDecoder(lengths), nil
+}
+
+// consumeValue deserializes a single Value from the binary stream.
+// It reads a literal/length symbol and reconstructs a literal, the end-of-block marker, or a
+// pointer whose distance follows the length.
+// Parameters:
+// - reps: The recent distances of the block, updated with the distance of a pointer.
+// Returns:
+// - A Value instance.
+// - An error if the deserialization fails, wrapping ErrTruncatedStream if the stream ends early.
+func (br *BinaryReader) consumeValue(reps *repDistances) (Value, error) {
+	sym, err := br.readSymbol(&br.litLen[0])
+	if err != nil {
+		return Value{}, truncated(err)
+	}
+	if sym < litLenEOB {
+		return NewValue(true, byte(sym), 0, 0), nil
+	}
+	if sym == litLenEOB {
+		return endOfBlock, nil
+	}
+
+	// Deserialize the rest of a pointer Value: the extra bits of its length, then its distance.
+	length, err := br.readExtra(lengthCode, sym-litLenEOB-1)
+	if err != nil {
+		return Value{}, truncated(err)
+	}
+	sym, err = br.readSymbol(&br.distances)
+	if err != nil {
+		return Value{}, truncated(err)
+	}
+	distance, err := br.readDistance(sym, reps)
+	if err != nil {
+		return Value{}, truncated(err)
+	}
+	return NewValue(false, 0, uint16(length), uint32(distance)), nil
+}
+
+// readSymbol decodes a single symbol with the decoder of its alphabet.
+// Returns:
+// - The corresponding symbol.
+// - An error if deserialization fails, wrapping ErrUnknownCode if no code matches.
+func (br *BinaryReader) readSymbol(d *huffmanDecoder) (int, error) {
+	return d.decode(br.r)
+}
+
+// readExtra reads the extra bits of a bucket symbol and returns the value they select.
+// Parameters:
+// - c: The extraCode of the alphabet.
+// - sym: The bucket symbol within c.
+// Returns:
+// - The selected value.
+// - An error wrapping ErrCorruptStream if the value is beyond the range of c, or the error of the
+// reader.
+func (br *BinaryReader) readExtra(c extraCode, sym int) (int, error) {
+	base, extraBits := c.bucket(sym)
+	v := base
+	if extraBits > 0 {
+		extra, err := br.r.ReadBits(extraBits)
+		if err != nil {
+			return 0, err
+		}
+		v += int(extra)
+	}
+	if v > c.last {
+		return 0, fmt.Errorf("BinaryReader.readExtra: value %d exceeds %d: %w", v, c.last, ErrCorruptStream)
+	}
+	return v, nil
+}
+
+// readDistance resolves a symbol of the distance alphabet: one of the recent distances, or a
+// bucket of distanceCode whose extra bits follow.
+// Parameters:
+// - sym: The symbol of the distance alphabet.
+// - reps: The recent distances of the block, updated with the distance.
+// Returns:
+// - The distance.
+// - An error wrapping ErrCorruptStream if the distance is beyond the range of distanceCode, or the
+// error of the reader.
+func (br *BinaryReader) readDistance(sym int, reps *repDistances) (int, error) {
+	if sym < repCodes {
+		return reps.use(sym), nil
+	}
+	distance, err := br.readExtra(distanceCode, sym-repCodes)
+	if err != nil {
+		return 0, err
+	}
+	reps.push(distance)
+	return distance, nil
+}
@@ -0,0 +1,55 @@
+// levels.go
+// Package lzhuff provides compression levels, which select a coherent preset of encoder settings.
+// Lower levels favor speed with a greedy parse, middle levels use lazy matching and the highest
+// levels use the optimal parser. Higher levels also search larger windows and spend more time on
+// entropy coding: literal contexts from level 5, tANS codes at level 7 and the range coder at
+// levels 8 and 9. Settings chosen explicitly through other options always take precedence over
+// the preset of the level.
+
+package lzhuff
+
+import "fmt"
+
+// Compression levels accepted by WithLevel.
+const (
+	MinLevel     = 1 // Fastest compression.
+	MaxLevel     = 9 // Best compression ratio.
+	DefaultLevel = 6 // Balance between speed and ratio.
+)
+
+// levelPreset holds the encoder settings selected by a compression level.
+type levelPreset struct {
+	strategy   parseStrategy // How the LZ77 stage chooses between literals and matches.
+	searchSize int           // Size of the LZ77 search window in bytes.
+	chainDepth int           // Maximum number of match candidates visited per position; 0 means unlimited.
+	niceLen    int           // Match length that ends the candidate search early; 0 means never.
+	coder      Coder         // Entropy coder of the blocks.
+	literalCtx bool          // Whether literals are coded in the context of the previous byte.
+}
+
+// levelPresets maps each compression level to its preset. Index 0 is unused.
+var levelPresets = [MaxLevel + 1]levelPreset{
+	1: {strategy: parseGreedy, searchSize: 1 << 16, chainDepth: 4, niceLen: 8, coder: CoderHuffman},
+	2: {strategy: parseGreedy, searchSize: 1 << 16, chainDepth: 8, niceLen: 16, coder: CoderHuffman},
+	3: {strategy: parseGreedy, searchSize: 1 << 17, chainDepth: 16, niceLen: 32, coder: CoderHuffman},
+	4: {strategy: parseLazy, searchSize: 1 << 18, chainDepth: 32, niceLen: 64, coder: CoderHuffman},
+	5: {strategy: parseLazy, searchSize: 1 << 18, chainDepth: 64, niceLen: 128, coder: CoderHuffman, literalCtx: true},
+	6: {strategy: parseLazy2, searchSize: DefaultSearchSize, chainDepth: 128, niceLen: 128, coder: CoderHuffman, literalCtx: true},
+	7: {strategy: parseLazy2, searchSize: 1 << 20, chainDepth: 256, niceLen: 255, coder: CoderFSE, literalCtx: true},
+	8: {strategy: parseOptimal, searchSize: 1 << 20, chainDepth: 512, niceLen: 255, coder: CoderRange, literalCtx: true},
+	9: {strategy: parseOptimal, searchSize: 1 << 22, chainDepth: 4096, niceLen: 0, coder: CoderRange, literalCtx: true},
+}
+
+// WithLevel selects the compression level, from MinLevel (fastest) to MaxLevel (smallest output).
+// The level provides defaults for the match finder and the entropy coder; options such as
+// WithChainDepth, WithSearchSize or WithCoder override them regardless of the order in which the
+// options are given.
+func WithLevel(level int) Option {
+	return func(c *config) error {
+		if level < MinLevel || level > MaxLevel {
+			return fmt.Errorf("lzhuff: level %d is outside the range %d to %d", level, MinLevel, MaxLevel)
+		}
+		c.level = level
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+// lsbwriter.go
+// Package lzhuff provides the bit writer of the DEFLATE encoder. The format of this package writes
+// its bits most significant first with bitio.Writer, while DEFLATE fills every byte starting with
+// its least significant bit and writes Huffman codes starting with their first bit, so it needs a
+// writer of its own.
+
+package lzhuff
+
+import (
+	"io"
+	"math/bits"
+)
+
+// lsbWriter collects a bit stream in the bit order of DEFLATE. The bytes are kept in memory until
+// they are flushed, so writing bits never fails.
+type lsbWriter struct {
+	out []byte // Complete bytes not flushed yet.
+	acc uint64 // Pending bits, the next one to be written being the least significant.
+	n   byte   // Number of pending bits, less than 8 between calls.
+}
+
+// writeBits writes the n low bits of v, least significant first, n being at most 56.
+func (w *lsbWriter) writeBits(v uint64, n byte) {
+	w.acc |= v << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc >>= 8
+		w.n -= 8
+	}
+}
+
+// writeCode writes a Huffman code starting with its first bit.
+func (w *lsbWriter) writeCode(c Code) {
+	w.writeBits(bits.Reverse64(c.c)>>(64-c.bits), c.bits)
+}
+
+// align pads the stream with zero bits up to the next byte boundary.
+func (w *lsbWriter) align() {
+	if w.n > 0 {
+		w.writeBits(0, 8-w.n)
+	}
+}
+
+// writeBytes writes p, which must start at a byte boundary.
+func (w *lsbWriter) writeBytes(p []byte) {
+	w.out = append(w.out, p...)
+}
+
+// flush writes the complete bytes collected so far to dst. The pending bits of an incomplete
+// byte stay behind until align completes it.
+func (w *lsbWriter) flush(dst io.Writer) error {
+	_, err := dst.Write(w.out)
+	w.out = w.out[:0]
+	return err
+}
@@ -0,0 +1,194 @@
+// lz4.go
+// Package lzhuff provides the LZ4 block format, which writes the literals and pointers of the
+// LZ77 stage as bytes instead of entropy coding them. Every sequence is a token holding the
+// lengths of a run of literals and of the match that follows it, the literals themselves and the
+// little-endian offset of the match; lengths that do not fit the four bits of the token continue
+// in bytes of 255. Decoding a block is a loop of byte copies, which makes LZ4 the fastest format
+// of this package to decompress, at the cost of the compression ratio.
+
+package lzhuff
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Limits of the LZ4 block format.
+const (
+	lz4MinMatch     = 4         // Length of the shortest match.
+	lz4MaxOffset    = 1<<16 - 1 // Largest match offset.
+	lz4EndLiterals  = 5         // Number of bytes at the end of a block that are always literals.
+	lz4MatchLimit   = 12        // Minimum distance from the start of the last match to the end of a block.
+	lz4TokenMax     = 15        // Largest length held by a half of the token.
+	lz4MaxBlockSize = 4 << 20   // Largest uncompressed block of the frame format.
+)
+
+// lz4Params returns the settings of the LZ77 stage described by c, clamped to the limits of LZ4:
+// matches of at least 4 bytes and offsets that fit in 16 bits.
+func (c *config) lz4Params() lzParams {
+	p := c.lzParams()
+	p.minMatch = max(p.minMatch, lz4MinMatch)
+	p.maxMatch = max(p.maxMatch, p.minMatch)
+	p.searchSize = min(p.searchSize, lz4MaxOffset)
+	return p
+}
+
+// CompressLZ4Block compresses src into a single LZ4 block, without the frame around it.
+// It accepts the options of NewWriter; only the LZ77 settings have an effect.
+// Parameters:
+// - src: The data to compress.
+// - opts: Options overriding the default compression settings.
+// Returns:
+// - The LZ4 block.
+// - An error if any of the options is invalid.
+func CompressLZ4Block(src []byte, opts ...Option) ([]byte, error) {
+	cfg, err := newConfig(defaultConfig(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return appendLZ4Block(nil, parseValues(src, 0, cfg.lz4Params()), src), nil
+}
+
+// DecompressLZ4Block decompresses a single LZ4 block.
+// Parameters:
+// - src: The LZ4 block.
+// - maxSize: The largest decompressed size accepted.
+// Returns:
+// - The decompressed data.
+// - An error wrapping ErrCorruptStream or ErrInvalidDistance if the block is malformed or
+// decompresses to more than maxSize bytes.
+func DecompressLZ4Block(src []byte, maxSize int) ([]byte, error) {
+	return decodeLZ4Block(nil, src, maxSize)
+}
+
+// appendLZ4Block appends the LZ4 block encoding of values to dst.
+// A block must end with at least 5 literals and its last match must start at least 12 bytes
+// before its end, so the matches breaking these rules are shortened or written as literals.
+// Parameters:
+// - dst: The slice the block is appended to.
+// - values: The LZ77 representation of data, with matches of at least 4 bytes and offsets that
+// fit in 16 bits.
+// - data: The bytes described by values.
+func appendLZ4Block(dst []byte, values []Value, data []byte) []byte {
+	litStart, pos := 0, 0
+	for _, v := range values {
+		if v.IsLiteral {
+			pos++
+			continue
+		}
+		if pos+lz4MatchLimit > len(data) {
+			break
+		}
+		length := min(int(v.length), len(data)-lz4EndLiterals-pos)
+		dst = appendLZ4Sequence(dst, data[litStart:pos], int(v.distance), length)
+		pos += length
+		litStart = pos
+		if length < int(v.length) {
+			// The match reached into the last literals, so the rest of the block is literals.
+			break
+		}
+	}
+	// The last sequence is made of literals only.
+	return appendLZ4Sequence(dst, data[litStart:], 0, 0)
+}
+
+// appendLZ4Sequence appends one sequence to dst: literals followed by a match of the given
+// length at the given offset, or by no match if offset is 0.
+func appendLZ4Sequence(dst, literals []byte, offset, length int) []byte {
+	token := byte(min(len(literals), lz4TokenMax)) << 4
+	if offset > 0 {
+		token |= byte(min(length-lz4MinMatch, lz4TokenMax))
+	}
+	dst = appendLZ4Length(append(dst, token), len(literals))
+	dst = append(dst, literals...)
+	if offset == 0 {
+		return dst
+	}
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(offset))
+	return appendLZ4Length(dst, length-lz4MinMatch)
+}
+
+// appendLZ4Length appends the bytes continuing a length n that does not fit in its half of the
+// token: bytes of 255 followed by the remainder.
+func appendLZ4Length(dst []byte, n int) []byte {
+	if n < lz4TokenMax {
+		return dst
+	}
+	for n -= lz4TokenMax; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// decodeLZ4Block appends the decompressed bytes of the LZ4 block src to window, whose bytes are
+// the history the matches of the block may refer to.
+// Parameters:
+// - window: The history followed by the space the block is decompressed into.
+// - src: The LZ4 block.
+// - limit: The largest number of bytes the block may decompress to.
+// Returns:
+// - window extended with the decompressed bytes.
+// - An error wrapping ErrCorruptStream or ErrInvalidDistance if the block is malformed.
+func decodeLZ4Block(window, src []byte, limit int) ([]byte, error) {
+	limit += len(window)
+	var n int
+	var err error
+	for pos := 0; ; {
+		if pos == len(src) {
+			return window, fmt.Errorf("decodeLZ4Block: block ends before its last literals: %w", ErrCorruptStream)
+		}
+		token := src[pos]
+		pos++
+
+		if n, pos, err = readLZ4Length(src, pos, int(token>>4)); err != nil {
+			return window, err
+		}
+		if n > len(src)-pos || n > limit-len(window) {
+			return window, fmt.Errorf("decodeLZ4Block: %d literals at byte %d: %w", n, pos, ErrCorruptStream)
+		}
+		window = append(window, src[pos:pos+n]...)
+		pos += n
+		if pos == len(src) {
+			// Only the last sequence has no match.
+			return window, nil
+		}
+
+		if len(src)-pos < 2 {
+			return window, fmt.Errorf("decodeLZ4Block: offset cut at byte %d: %w", pos, ErrCorruptStream)
+		}
+		offset := int(binary.LittleEndian.Uint16(src[pos:]))
+		pos += 2
+		if offset == 0 || offset > len(window) {
+			return window, fmt.Errorf("decodeLZ4Block: offset %d with %d bytes of window: %w", offset, len(window), ErrInvalidDistance)
+		}
+		if n, pos, err = readLZ4Length(src, pos, int(token&0x0f)); err != nil {
+			return window, err
+		}
+		if n += lz4MinMatch; n > limit-len(window) {
+			return window, fmt.Errorf("decodeLZ4Block: match of %d bytes at byte %d: %w", n, pos, ErrCorruptStream)
+		}
+		window = appendMatch(window, offset, n)
+	}
+}
+
+// readLZ4Length reads the bytes continuing the length n held by a half of a token, from src at
+// pos.
+// Returns:
+// - The length and the position following its last byte.
+// - An error wrapping ErrCorruptStream if the block ends within the length.
+func readLZ4Length(src []byte, pos, n int) (int, int, error) {
+	if n < lz4TokenMax {
+		return n, pos, nil
+	}
+	for {
+		if pos == len(src) {
+			return 0, pos, fmt.Errorf("readLZ4Length: block ends within a length: %w", ErrCorruptStream)
+		}
+		b := src[pos]
+		pos++
+		n += int(b)
+		if b < 255 {
+			return n, pos, nil
+		}
+	}
+}
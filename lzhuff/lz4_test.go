@@ -0,0 +1,248 @@
+// lz4_test.go
+// Package lzhuff contains tests for the LZ4 block and frame formats.
+// These tests verify that blocks follow the end-of-block rules of LZ4, that LZ4Reader restores the
+// input from the frames written by LZ4Writer and decodes a frame written by the lz4 tool, and that
+// malformed frames are rejected with the matching sentinel error.
+
+package lzhuff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// lz4Compress compresses input into an LZ4 frame with the given options.
+func lz4Compress(t *testing.T, input []byte, opts ...Option) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	zw, err := NewLZ4Writer(&compressed, opts...)
+	if err != nil {
+		t.Fatalf("NewLZ4Writer() error = %v", err)
+	}
+	if _, err := zw.Write(input); err != nil {
+		t.Fatalf("LZ4Writer.Write() error = %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("LZ4Writer.Close() error = %v", err)
+	}
+	return compressed.Bytes()
+}
+
+// Test_appendLZ4Block tests the encoding of blocks, including the matches shortened or dropped to
+// keep the last bytes of a block literal.
+func Test_appendLZ4Block(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  []byte
+	}{
+		{name: "Empty", input: nil, want: []byte{0x00}},
+		{name: "Too short for a match", input: []byte("abcabcabcab"), want: append([]byte{0xb0}, "abcabcabcab"...)},
+		{name: "Match shortened before the last literals", input: bytes.Repeat([]byte{'a'}, 20),
+			want: []byte{0x56, 'a', 'a', 'a', 'a', 'a', 0x01, 0x00, 0x50, 'a', 'a', 'a', 'a', 'a'}},
+		{name: "Long literal run", input: []byte("abcdefghijklmnop"), want: append([]byte{0xf0, 0x01}, "abcdefghijklmnop"...)},
+		{name: "Long match", input: bytes.Repeat([]byte{'a'}, 300),
+			want: []byte{0x5f, 'a', 'a', 'a', 'a', 'a', 0x01, 0x00, 0xff, 0x10, 0x50, 'a', 'a', 'a', 'a', 'a'}},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			got, err := CompressLZ4Block(tt.input, WithMaxMatch(MaxMatchLength))
+			if err != nil {
+				t.Fatalf("CompressLZ4Block() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("CompressLZ4Block() = %x; want %x", got, tt.want)
+			}
+			decoded, err := DecompressLZ4Block(got, len(tt.input))
+			if err != nil {
+				t.Fatalf("DecompressLZ4Block() error = %v", err)
+			}
+			if !bytes.Equal(decoded, tt.input) {
+				t.Errorf("DecompressLZ4Block() does not restore the input")
+			}
+		})
+	}
+}
+
+// Test_LZ4Writer tests that LZ4Reader restores the input and reports the frame descriptor
+// written for the settings.
+func Test_LZ4Writer(t *testing.T) {
+	words := testCorpus()["Words"]
+	tests := []struct {
+		name       string
+		input      []byte
+		opts       []Option
+		wantHeader LZ4Header
+	}{
+		{name: "Defaults", input: words, wantHeader: LZ4Header{BlockMaxSize: 1 << 20, ContentSize: int64(len(words))}},
+		{name: "Linked blocks", input: words, opts: []Option{WithBlockSize(5000), WithSearchSize(MaxSearchSize)},
+			wantHeader: LZ4Header{BlockMaxSize: 1 << 16, ContentSize: -1}},
+		{name: "Content size", input: words, opts: []Option{WithBlockSize(5000), WithContentSize(int64(len(words)))},
+			wantHeader: LZ4Header{BlockMaxSize: 1 << 16, ContentSize: int64(len(words))}},
+		{name: "Independent blocks", input: words, opts: []Option{WithBlockSize(5000), WithSearchSize(0)},
+			wantHeader: LZ4Header{BlockMaxSize: 1 << 16, ContentSize: -1}},
+		{name: "Largest blocks", input: words, opts: []Option{WithBlockSize(32 << 20), WithLevel(MaxLevel)},
+			wantHeader: LZ4Header{BlockMaxSize: 4 << 20, ContentSize: int64(len(words))}},
+		{name: "Incompressible", input: testCorpus()["Random bytes"], opts: []Option{WithBlockSize(3000)},
+			wantHeader: LZ4Header{BlockMaxSize: 1 << 16, ContentSize: -1}},
+		{name: "Single run", input: testCorpus()["Single run"], wantHeader: LZ4Header{BlockMaxSize: 1 << 20, ContentSize: 5000}},
+		{name: "Empty input", input: nil, wantHeader: LZ4Header{BlockMaxSize: 1 << 20, ContentSize: 0}},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			compressed := lz4Compress(t, tt.input, tt.opts...)
+			zr, err := NewLZ4Reader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("NewLZ4Reader() error = %v", err)
+			}
+			if header := zr.Header(); header != tt.wantHeader {
+				t.Errorf("Header() = %+v; want %+v", header, tt.wantHeader)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("LZ4Reader.Read() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.input) {
+				t.Errorf("LZ4Reader does not restore the input")
+			}
+		})
+	}
+}
+
+// Test_LZ4Reader tests that LZ4Reader decodes a frame of the lz4 tool, concatenated frames with a
+// skippable frame between them, and reads of a single byte.
+func Test_LZ4Reader(t *testing.T) {
+	// Written by lz4 -BD -BX --content-size: linked blocks, block checksums and the content size.
+	golden, _ := hex.DecodeString("04224d187c403600000000000000dc240000006d68656c6c6f200600f5022c204c5a34206672616d6520746573742c2300506c6c6f210ad9870ac700000000199cf6e5")
+	goldenText := []byte("hello hello hello hello, LZ4 frame test, hello hello!\n")
+	words := testCorpus()["Words"]
+
+	skippable := binary.LittleEndian.AppendUint32(nil, lz4SkippableMagic+5)
+	skippable = binary.LittleEndian.AppendUint32(skippable, 3)
+	skippable = append(skippable, "abc"...)
+	var concatenated []byte
+	concatenated = append(concatenated, golden...)
+	concatenated = append(concatenated, skippable...)
+	concatenated = append(concatenated, lz4Compress(t, words, WithBlockSize(5000))...)
+	concatenated = append(concatenated, skippable...)
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  []byte
+	}{
+		{name: "lz4 tool", input: golden, want: goldenText},
+		{name: "Concatenated frames", input: concatenated, want: append(append([]byte{}, goldenText...), words...)},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			for _, oneByte := range []bool{false, true} {
+				var r io.Reader = bytes.NewReader(tt.input)
+				if oneByte {
+					r = iotest.OneByteReader(r)
+				}
+				zr, err := NewLZ4Reader(r)
+				if err != nil {
+					t.Fatalf("NewLZ4Reader() error = %v", err)
+				}
+				r = zr
+				if oneByte {
+					r = iotest.OneByteReader(zr)
+				}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("LZ4Reader.Read() error = %v", err)
+				}
+				if !bytes.Equal(got, tt.want) {
+					t.Errorf("one-byte reads %v: LZ4Reader does not restore the input", oneByte)
+				}
+			}
+		})
+	}
+}
+
+// Test_LZ4ReaderCorrupt tests that malformed frames fail with the matching sentinel error.
+func Test_LZ4ReaderCorrupt(t *testing.T) {
+	words := testCorpus()["Words"]
+	// The descriptor of valid holds the content size, so the header checksum is at byte 14 and
+	// the first block starts at byte 19.
+	valid := lz4Compress(t, words, WithContentSize(int64(len(words))))
+
+	// modified returns a copy of valid changed by modify.
+	modified := func(modify func(frame []byte)) []byte {
+		frame := append([]byte{}, valid...)
+		modify(frame)
+		return frame
+	}
+	// frame returns a frame without checksums made of the given blocks.
+	frame := func(blocks ...[]byte) []byte {
+		out := binary.LittleEndian.AppendUint32(nil, lz4Magic)
+		out = append(out, lz4Version, lz4MinBlockCode<<4)
+		out = append(out, byte(xxHash32Sum(out[4:])>>8))
+		for _, block := range blocks {
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(block)))
+			out = append(out, block...)
+		}
+		return binary.LittleEndian.AppendUint32(out, lz4EndMark)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{name: "Truncated", input: valid[:len(valid)/2], wantErr: ErrTruncatedStream},
+		{name: "Empty", input: nil, wantErr: ErrTruncatedStream},
+		{name: "Magic number", input: modified(func(f []byte) { f[0]++ }), wantErr: ErrInvalidHeader},
+		{name: "Legacy format", input: binary.LittleEndian.AppendUint32(nil, lz4LegacyMagic), wantErr: ErrUnsupportedVersion},
+		{name: "Version", input: modified(func(f []byte) { f[4] ^= lz4VersionMask }), wantErr: ErrUnsupportedVersion},
+		{name: "Dictionary ID", input: modified(func(f []byte) { f[4] |= lz4FlagDictID }), wantErr: ErrUnsupportedVersion},
+		{name: "Header checksum", input: modified(func(f []byte) { f[14]++ }), wantErr: ErrChecksum},
+		{name: "Block checksum", input: modified(func(f []byte) { f[20]++ }), wantErr: ErrChecksum},
+		{name: "Content checksum", input: modified(func(f []byte) { f[len(f)-1]++ }), wantErr: ErrChecksum},
+		{name: "Content size", input: modified(func(f []byte) {
+			binary.LittleEndian.PutUint64(f[6:], uint64(len(words)+1))
+			f[14] = byte(xxHash32Sum(f[4:14]) >> 8)
+		}), wantErr: ErrSizeMismatch},
+		{name: "Block too large", input: modified(func(f []byte) {
+			binary.LittleEndian.PutUint32(f[15:], lz4SizeMask)
+		}), wantErr: ErrCorruptStream},
+		{name: "Offset before the start", input: frame([]byte{0x10, 'a', 0x02, 0x00, 0x00}), wantErr: ErrInvalidDistance},
+		{name: "Zero offset", input: frame([]byte{0x10, 'a', 0x00, 0x00, 0x00}), wantErr: ErrInvalidDistance},
+		{name: "Literals past the block", input: frame([]byte{0x50, 'a'}), wantErr: ErrCorruptStream},
+		{name: "Block ends within a length", input: frame([]byte{0xf0, 0xff}), wantErr: ErrCorruptStream},
+		{name: "No last literals", input: frame([]byte{0x10, 'a', 0x01, 0x00}), wantErr: ErrCorruptStream},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			zr, err := NewLZ4Reader(bytes.NewReader(tt.input))
+			if err == nil {
+				_, err = io.ReadAll(zr)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LZ4Reader error = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+// lz4frame.go
+// Package lzhuff provides LZ4Writer and LZ4Reader, which wrap LZ4 blocks in the LZ4 frame format:
+// a magic number and a frame descriptor announcing the block size, the checksums and optionally
+// the content size, followed by the blocks, each prefixed with its size and followed by its
+// xxHash32, an end mark and the xxHash32 of the uncompressed data. The frames LZ4Writer writes
+// decode with the lz4 tool, and LZ4Reader reads the frames of the lz4 tool. LZ4Writer shares the
+// options, the block buffering and the LZ77 stage of Writer; the blocks are linked, so matches
+// reach back into the previous blocks through the sliding window.
+
+package lzhuff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Fields of the LZ4 frame format.
+const (
+	lz4Magic          = 0x184d2204 // Magic number of a frame.
+	lz4LegacyMagic    = 0x184c2102 // Magic number of a frame in the legacy format.
+	lz4SkippableMagic = 0x184d2a50 // Magic number of a skippable frame, in any of its low 4 bits.
+	lz4SkippableMask  = 0xfffffff0 // Bits of the magic number identifying a skippable frame.
+
+	lz4Version         = 0x40 // Version 01 in the two high bits of the flags byte.
+	lz4VersionMask     = 0xc0 // Bits of the flags byte holding the version.
+	lz4FlagIndependent = 0x20 // Flag of a frame whose blocks do not refer to the previous blocks.
+	lz4FlagBlockSum    = 0x10 // Flag of a frame whose blocks are followed by their xxHash32.
+	lz4FlagSize        = 0x08 // Flag of a frame descriptor holding the content size.
+	lz4FlagContentSum  = 0x04 // Flag of a frame ending with the xxHash32 of its content.
+	lz4FlagReserved    = 0x02 // Reserved bit of the flags byte.
+	lz4FlagDictID      = 0x01 // Flag of a frame descriptor holding a dictionary ID.
+	lz4BDReserved      = 0x8f // Reserved bits of the block descriptor byte.
+
+	lz4MinBlockCode = 4         // Code of the smallest block maximum size, 64 KiB.
+	lz4Uncompressed = 1 << 31   // Bit of a block size marking a block stored uncompressed.
+	lz4EndMark      = 0         // Block size ending the blocks of a frame.
+	lz4SizeMask     = 1<<31 - 1 // Bits of a block size holding the size.
+	lz4Window       = 1<<16 - 1 // Number of bytes of history linked blocks may refer to.
+)
+
+// lz4BlockMaxSize returns the largest uncompressed size of a block for a block maximum size code
+// from 4 to 7.
+func lz4BlockMaxSize(code int) int {
+	return 1 << (8 + 2*code)
+}
+
+// LZ4Writer is an io.WriteCloser that compresses the data written to it into an LZ4 frame.
+// Data is compressed one block at a time; Close compresses the final block and ends the frame.
+type LZ4Writer struct {
+	w         io.Writer  // Destination of the compressed stream.
+	cfg       config     // Settings applied by the options passed to NewLZ4Writer.
+	params    lzParams   // Settings of the LZ77 stage, clamped to the limits of LZ4.
+	in        blockInput // Sliding window: history followed by the input not compressed yet.
+	blockCode int        // Code of the block maximum size recorded in the frame descriptor.
+	sum       *xxHash32  // xxHash32 of the uncompressed bytes compressed so far.
+	out       []byte     // Buffer the next block is encoded into.
+	started   bool       // Whether the frame descriptor has been written.
+	size      uint64     // Number of uncompressed bytes compressed so far.
+	closed    bool       // Whether Close has already been called.
+	err       error      // First error encountered, returned by every later call.
+}
+
+// NewLZ4Writer returns a new LZ4Writer compressing data to w.
+// It accepts the options of NewWriter. The coder, the literal contexts and the code length limit
+// have no effect, as LZ4 has no entropy coding, the LZ77 settings are clamped to the limits of LZ4
+// (matches of at least 4 bytes and a window of less than 64 KiB) and blocks hold at most 4 MiB.
+// Parameters:
+// - w: The io.Writer that receives the compressed stream.
+// - opts: Options overriding the default compression settings.
+func NewLZ4Writer(w io.Writer, opts ...Option) (*LZ4Writer, error) {
+	cfg, err := newConfig(defaultConfig(), opts)
+	if err != nil {
+		return nil, err
+	}
+	// The block maximum size is the smallest of the frame format that holds a block.
+	blockSize := min(cfg.blockSize, lz4MaxBlockSize)
+	code := lz4MinBlockCode
+	for lz4BlockMaxSize(code) < blockSize {
+		code++
+	}
+	return &LZ4Writer{
+		w:         w,
+		cfg:       cfg,
+		params:    cfg.lz4Params(),
+		in:        blockInput{blockSize: blockSize},
+		blockCode: code,
+		sum:       newXXHash32(0),
+	}, nil
+}
+
+// Write collects p for compression, compressing a block every time a full block of input is
+// pending. It implements io.Writer.
+func (z *LZ4Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errors.New("lzhuff: write to closed LZ4Writer")
+	}
+	written, err := z.in.write(p, z.writeBlock)
+	z.err = err
+	return written, err
+}
+
+// Close compresses the remaining input as the final block and writes the end mark and the
+// content checksum. It does not close the underlying io.Writer.
+func (z *LZ4Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+
+	if z.err = z.writeBlock(z.in.pending()); z.err != nil {
+		return z.err
+	}
+	z.cfg.logf("Input size (bytes): %d\n", z.size)
+	if z.cfg.contentSize >= 0 && uint64(z.cfg.contentSize) != z.size {
+		z.err = fmt.Errorf("LZ4Writer.Close: wrote %d bytes, content size is %d: %w", z.size, z.cfg.contentSize, ErrSizeMismatch)
+		return z.err
+	}
+	end := binary.LittleEndian.AppendUint32(nil, lz4EndMark)
+	end = binary.LittleEndian.AppendUint32(end, z.sum.Sum32())
+	if _, err := z.w.Write(end); err != nil {
+		z.err = fmt.Errorf("LZ4Writer.Close: %w", err)
+	}
+	return z.err
+}
+
+// writeHeader writes the magic number and the frame descriptor before the first block.
+// The content size is recorded when it is known up front: either it was given with
+// WithContentSize, or the LZ4Writer was closed before a block had to be compressed.
+func (z *LZ4Writer) writeHeader() error {
+	flags := byte(lz4Version | lz4FlagBlockSum | lz4FlagContentSum)
+	if z.params.searchSize == 0 {
+		flags |= lz4FlagIndependent
+	}
+	descriptor := []byte{flags, byte(z.blockCode) << 4}
+	switch {
+	case z.cfg.contentSize >= 0:
+		descriptor[0] |= lz4FlagSize
+		descriptor = binary.LittleEndian.AppendUint64(descriptor, uint64(z.cfg.contentSize))
+	case z.closed:
+		descriptor[0] |= lz4FlagSize
+		descriptor = binary.LittleEndian.AppendUint64(descriptor, uint64(z.in.pending()))
+	}
+
+	header := binary.LittleEndian.AppendUint32(nil, lz4Magic)
+	header = append(header, descriptor...)
+	header = append(header, byte(xxHash32Sum(descriptor)>>8))
+	z.started = true
+	if _, err := z.w.Write(header); err != nil {
+		return fmt.Errorf("LZ4Writer.writeHeader: %w", err)
+	}
+	return nil
+}
+
+// writeBlock compresses the next n pending bytes as one block, then slides the window so that
+// only the last 64 KiB of history are kept. The block is stored uncompressed if compression does
+// not make it smaller, and an empty block is not written, as its size would be the end mark.
+func (z *LZ4Writer) writeBlock(n int) error {
+	if !z.started {
+		if err := z.writeHeader(); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	buf, start := z.in.buf[:z.in.history+n], z.in.history
+	// LZ coding, with pointers allowed into the history kept in the window.
+	values := parseValues(buf, start, z.params)
+	if err := z.cfg.traceValues(values); err != nil {
+		return err
+	}
+
+	// The block follows its size in the buffer, and its checksum follows it.
+	out := append(z.out[:0], 0, 0, 0, 0)
+	out = appendLZ4Block(out, values, buf[start:])
+	size := uint32(len(out) - 4)
+	if int(size) >= n {
+		out = append(out[:4], buf[start:]...)
+		size = uint32(n) | lz4Uncompressed
+	}
+	binary.LittleEndian.PutUint32(out, size)
+	out = binary.LittleEndian.AppendUint32(out, xxHash32Sum(out[4:]))
+	z.out = out
+	if _, err := z.w.Write(out); err != nil {
+		return fmt.Errorf("LZ4Writer.writeBlock: %w", err)
+	}
+	z.sum.Write(buf[start:])
+	z.size += uint64(n)
+
+	z.in.slide(len(buf), z.params.searchSize)
+	return nil
+}
+
+// LZ4Header holds the fields of an LZ4 frame descriptor.
+type LZ4Header struct {
+	BlockMaxSize int   // Largest uncompressed size of a block of the frame.
+	ContentSize  int64 // Length of the uncompressed data of the frame, or -1 if none is recorded.
+}
+
+// LZ4Reader is an io.Reader that decompresses an LZ4 stream read from an underlying io.Reader.
+// Like the lz4 tool, it decodes every frame of a stream made of several concatenated frames and
+// skips the skippable frames. Frames depending on a dictionary and the legacy format are not
+// supported.
+type LZ4Reader struct {
+	r      io.Reader // Source of the compressed stream.
+	header LZ4Header // Frame descriptor of the current frame.
+	flags  byte      // Flags byte of the current frame.
+	block  []byte    // Compressed data of the current block.
+	window []byte    // History followed by the bytes of the current block.
+	out    []byte    // Decompressed bytes of the current block not yet returned to the caller.
+	sum    *xxHash32 // xxHash32 of the uncompressed bytes of the current frame.
+	size   uint64    // Number of uncompressed bytes of the current frame.
+	done   bool      // Whether the stream has been decoded and verified.
+	err    error     // Error encountered while decoding, returned by every later Read.
+}
+
+// NewLZ4Reader returns a new LZ4Reader decompressing data from r.
+// It reads and validates the descriptor of the first frame before returning. Only the bytes of
+// the stream are consumed from r.
+// Parameters:
+// - r: The io.Reader providing the compressed stream.
+// Returns:
+// - The LZ4Reader.
+// - An error wrapping ErrInvalidHeader, ErrUnsupportedVersion, ErrChecksum or ErrTruncatedStream
+// if the descriptor cannot be used.
+func NewLZ4Reader(r io.Reader) (*LZ4Reader, error) {
+	z := &LZ4Reader{r: r, sum: newXXHash32(0)}
+	if err := z.nextFrame(); err != nil {
+		return nil, err
+	}
+	if z.done {
+		return nil, fmt.Errorf("NewLZ4Reader: no LZ4 frame: %w", ErrTruncatedStream)
+	}
+	return z, nil
+}
+
+// Header returns the frame descriptor of the frame being decoded.
+func (z *LZ4Reader) Header() LZ4Header {
+	return z.header
+}
+
+// Read reads decompressed data into p. It implements io.Reader.
+// The checksums and the content size of every frame are verified as it is decoded, so Read only
+// returns io.EOF for an intact stream.
+func (z *LZ4Reader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		if z.done {
+			return 0, io.EOF
+		}
+		z.err = z.readBlock()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+// readUint32 reads a little-endian 32-bit field. It returns io.EOF if the stream ends before it.
+func (z *LZ4Reader) readUint32() (uint32, error) {
+	var field [4]byte
+	if _, err := io.ReadFull(z.r, field[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(field[:]), nil
+}
+
+// nextFrame skips the skippable frames and reads the descriptor of the next frame. It sets z.done
+// if the stream ends first.
+func (z *LZ4Reader) nextFrame() error {
+	for {
+		magic, err := z.readUint32()
+		switch {
+		case err == io.EOF:
+			z.done = true
+			return nil
+		case err != nil:
+			return fmt.Errorf("LZ4Reader.nextFrame: reading magic number: %w", truncated(err))
+		case magic == lz4Magic:
+			return z.readDescriptor()
+		case magic&lz4SkippableMask == lz4SkippableMagic:
+			size, err := z.readUint32()
+			if err != nil {
+				return fmt.Errorf("LZ4Reader.nextFrame: reading skippable frame size: %w", truncated(err))
+			}
+			if _, err := io.CopyN(io.Discard, z.r, int64(size)); err != nil {
+				return fmt.Errorf("LZ4Reader.nextFrame: skipping %d bytes: %w", size, truncated(err))
+			}
+		case magic == lz4LegacyMagic:
+			return fmt.Errorf("LZ4Reader.nextFrame: legacy frame: %w", ErrUnsupportedVersion)
+		default:
+			return fmt.Errorf("LZ4Reader.nextFrame: magic number %#08x: %w", magic, ErrInvalidHeader)
+		}
+	}
+}
+
+// readDescriptor reads the frame descriptor following the magic number of a frame and prepares
+// the decoding of its blocks.
+func (z *LZ4Reader) readDescriptor() error {
+	descriptor := make([]byte, 2, 10)
+	if _, err := io.ReadFull(z.r, descriptor); err != nil {
+		return fmt.Errorf("LZ4Reader.readDescriptor: %w", truncated(err))
+	}
+	flags, bd := descriptor[0], descriptor[1]
+	if flags&lz4VersionMask != lz4Version || flags&lz4FlagReserved != 0 || bd&lz4BDReserved != 0 {
+		return fmt.Errorf("LZ4Reader.readDescriptor: flags %#02x with block descriptor %#02x: %w", flags, bd, ErrUnsupportedVersion)
+	}
+	if flags&lz4FlagDictID != 0 {
+		return fmt.Errorf("LZ4Reader.readDescriptor: dictionary ID: %w", ErrUnsupportedVersion)
+	}
+	code := int(bd >> 4)
+	if code < lz4MinBlockCode {
+		return fmt.Errorf("LZ4Reader.readDescriptor: block maximum size code %d: %w", code, ErrInvalidHeader)
+	}
+	z.header = LZ4Header{BlockMaxSize: lz4BlockMaxSize(code), ContentSize: -1}
+	if flags&lz4FlagSize != 0 {
+		descriptor = descriptor[:10]
+		if _, err := io.ReadFull(z.r, descriptor[2:]); err != nil {
+			return fmt.Errorf("LZ4Reader.readDescriptor: reading content size: %w", truncated(err))
+		}
+		size := binary.LittleEndian.Uint64(descriptor[2:])
+		if size > math.MaxInt64 {
+			return fmt.Errorf("LZ4Reader.readDescriptor: content size %d: %w", size, ErrInvalidHeader)
+		}
+		z.header.ContentSize = int64(size)
+	}
+	var hc [1]byte
+	if _, err := io.ReadFull(z.r, hc[:]); err != nil {
+		return fmt.Errorf("LZ4Reader.readDescriptor: reading header checksum: %w", truncated(err))
+	}
+	if want := byte(xxHash32Sum(descriptor) >> 8); hc[0] != want {
+		return fmt.Errorf("LZ4Reader.readDescriptor: header checksum %#02x, computed %#02x: %w", hc[0], want, ErrChecksum)
+	}
+
+	z.flags = flags
+	z.window = z.window[:0]
+	z.sum.Reset()
+	z.size = 0
+	return nil
+}
+
+// readBlock reads the next block of the current frame into the window and points z.out at its
+// bytes, or ends the frame at its end mark.
+func (z *LZ4Reader) readBlock() error {
+	size, err := z.readUint32()
+	if err != nil {
+		return fmt.Errorf("LZ4Reader.readBlock: reading block size: %w", truncated(err))
+	}
+	if size == lz4EndMark {
+		return z.endFrame()
+	}
+	compressed := size&lz4Uncompressed == 0
+	n := int(size & lz4SizeMask)
+	if n > z.header.BlockMaxSize {
+		return fmt.Errorf("LZ4Reader.readBlock: block of %d bytes, at most %d allowed: %w", n, z.header.BlockMaxSize, ErrCorruptStream)
+	}
+	z.block = append(z.block[:0], make([]byte, n)...)
+	if _, err := io.ReadFull(z.r, z.block); err != nil {
+		return fmt.Errorf("LZ4Reader.readBlock: %w", truncated(err))
+	}
+	if z.flags&lz4FlagBlockSum != 0 {
+		sum, err := z.readUint32()
+		if err != nil {
+			return fmt.Errorf("LZ4Reader.readBlock: reading block checksum: %w", truncated(err))
+		}
+		if want := xxHash32Sum(z.block); sum != want {
+			return fmt.Errorf("LZ4Reader.readBlock: stored xxHash32 %#08x, computed %#08x: %w", sum, want, ErrChecksum)
+		}
+	}
+
+	// Drop the history the block cannot refer to.
+	switch {
+	case z.flags&lz4FlagIndependent != 0:
+		z.window = z.window[:0]
+	case len(z.window) > lz4Window:
+		z.window = z.window[:copy(z.window, z.window[len(z.window)-lz4Window:])]
+	}
+	start := len(z.window)
+	if compressed {
+		if z.window, err = decodeLZ4Block(z.window, z.block, z.header.BlockMaxSize); err != nil {
+			return err
+		}
+	} else {
+		z.window = append(z.window, z.block...)
+	}
+	z.out = z.window[start:]
+	z.sum.Write(z.out)
+	z.size += uint64(len(z.out))
+	return nil
+}
+
+// endFrame verifies the content size and the content checksum of the frame just decoded and reads
+// the descriptor of the next frame, if any follows.
+func (z *LZ4Reader) endFrame() error {
+	if z.header.ContentSize >= 0 && uint64(z.header.ContentSize) != z.size {
+		return fmt.Errorf("LZ4Reader.endFrame: content size %d, decoded %d bytes: %w", z.header.ContentSize, z.size, ErrSizeMismatch)
+	}
+	if z.flags&lz4FlagContentSum != 0 {
+		sum, err := z.readUint32()
+		if err != nil {
+			return fmt.Errorf("LZ4Reader.endFrame: reading content checksum: %w", truncated(err))
+		}
+		if want := z.sum.Sum32(); sum != want {
+			return fmt.Errorf("LZ4Reader.endFrame: stored xxHash32 %#08x, computed %#08x: %w", sum, want, ErrChecksum)
+		}
+	}
+	return z.nextFrame()
+}
@@ -0,0 +1,321 @@
+// lzhuff.go
+// Package lzhuff implements a compression format that combines LZ77 and Huffman coding.
+// Repeated sequences in the input are replaced by pointers to earlier occurrences, and the
+// resulting stream of literals and pointers is encoded with a Huffman code built from its
+// byte frequencies.
+//
+// The package exposes a Writer that compresses everything written to it and a Reader that
+// decompresses a stream produced by the Writer. Both follow the io.WriteCloser/io.Reader
+// conventions of the standard library compression packages and work on bounded memory:
+// the data is processed in blocks, with pointers reaching back into earlier blocks through a
+// sliding window.
+package lzhuff
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// Default LZ77 parameters used when no options are supplied to NewWriter.
+const (
+	DefaultMinMatch   = 4       // Minimum match length for a pointer to be emitted.
+	DefaultMaxMatch   = 255     // Maximum match length of a single pointer.
+	DefaultSearchSize = 1 << 18 // Size of the search window in bytes at DefaultLevel.
+)
+
+// Limits of the LZ77 parameters accepted by NewWriter.
+const (
+	MaxMatchLength = 1<<16 - 1 // Longest match a single pointer can describe.
+	MaxSearchSize  = 1 << 24   // Largest search window in bytes.
+)
+
+// DefaultMaxCodeBits is the length of the longest Huffman code when WithMaxCodeBits is not given.
+const DefaultMaxCodeBits = 15
+
+// minCodeBits is the smallest code length limit that still leaves room for a code for every symbol
+// of the literal/length alphabet.
+const minCodeBits = 9
+
+// Coder selects the entropy coder of the blocks of a stream.
+type Coder byte
+
+// Entropy coders accepted by WithCoder.
+const (
+	// CoderHuffman codes every block with canonical Huffman codes, whose tables are stored in the
+	// block unless the block reuses the tables of the previous one.
+	CoderHuffman Coder = iota
+	// CoderRange codes the stream with an adaptive binary range coder. It stores no tables and
+	// spends fractions of a bit on very likely symbols, at the cost of slower coding.
+	CoderRange
+	// CoderFSE codes every block with tANS (Finite State Entropy) codes, whose normalized
+	// frequencies are stored in the block. It spends fractions of a bit like the range coder while
+	// decoding with one table lookup per symbol like Huffman codes.
+	CoderFSE
+)
+
+// coderNames maps every Coder to its name.
+var coderNames = map[Coder]string{
+	CoderHuffman: "huffman",
+	CoderRange:   "range",
+	CoderFSE:     "fse",
+}
+
+// String returns the name of c.
+func (c Coder) String() string {
+	if name, ok := coderNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Coder(%d)", byte(c))
+}
+
+// ParseCoder returns the Coder with the given name, as returned by Coder.String.
+func ParseCoder(name string) (Coder, error) {
+	for c, n := range coderNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("lzhuff: unknown coder %q", name)
+}
+
+// DefaultBlockSize is the length of the uncompressed data compressed together as one block
+// when WithBlockSize is not given.
+const DefaultBlockSize = 1 << 20
+
+// config holds the settings of a Writer. It is populated by the Option functions.
+type config struct {
+	minMatch      int   // Minimum match length for the LZ77 stage.
+	maxMatch      int   // Maximum match length for the LZ77 stage.
+	level         int   // Compression level providing the defaults of the settings below.
+	searchSize    int   // Size of the LZ77 search window; -1 uses the level.
+	chainDepth    int   // Maximum number of match candidates visited per position; -1 uses the level.
+	contentSize   int64 // Announced length of the uncompressed data; -1 when unknown.
+	blockSize     int   // Length of the uncompressed data of every block but the last.
+	maxCodeBits   int   // Length of the longest Huffman code.
+	coder         Coder // Entropy coder of the blocks.
+	coderSet      bool  // Whether coder was chosen explicitly rather than by the level.
+	literalCtx    bool  // Whether literal/length symbols are coded in the context of the previous byte.
+	literalCtxSet bool  // Whether literalCtx was chosen explicitly rather than by the level.
+
+	fileName string    // Name of the original file recorded in a gzip header.
+	modTime  time.Time // Modification time of the original file recorded in a gzip header.
+
+	graphviz io.Writer   // Optional destination for the Graphviz Huffman tree.
+	lzTrace  io.Writer   // Optional destination for the LZ77 representation.
+	logger   *log.Logger // Optional destination of diagnostic messages.
+}
+
+// defaultConfig returns a config populated with the package defaults.
+func defaultConfig() config {
+	return config{
+		minMatch:    DefaultMinMatch,
+		maxMatch:    DefaultMaxMatch,
+		level:       DefaultLevel,
+		searchSize:  -1,
+		chainDepth:  -1,
+		contentSize: -1,
+		blockSize:   DefaultBlockSize,
+		maxCodeBits: DefaultMaxCodeBits,
+	}
+}
+
+// newConfig returns base with opts applied in order and the settings they left unset taken from
+// the preset of the compression level.
+// Parameters:
+// - base: The defaults of the format being written.
+// - opts: Options overriding the defaults.
+// Returns:
+// - The settings of the Writer.
+// - An error if any of the options is invalid or the settings do not fit together.
+func newConfig(base config, opts []Option) (config, error) {
+	c := base
+	for _, opt := range opts {
+		if err := opt(&c); err != nil {
+			return config{}, err
+		}
+	}
+	preset := levelPresets[c.level]
+	if c.searchSize < 0 {
+		c.searchSize = preset.searchSize
+	}
+	if c.chainDepth < 0 {
+		c.chainDepth = preset.chainDepth
+	}
+	if !c.coderSet {
+		c.coder = preset.coder
+	}
+	if !c.literalCtxSet {
+		c.literalCtx = preset.literalCtx
+	}
+	if err := c.validate(); err != nil {
+		return config{}, err
+	}
+	return c, nil
+}
+
+// lzParams returns the settings of the LZ77 stage described by c.
+func (c *config) lzParams() lzParams {
+	preset := levelPresets[c.level]
+	return lzParams{
+		minMatch:   c.minMatch,
+		maxMatch:   c.maxMatch,
+		searchSize: c.searchSize,
+		chainDepth: c.chainDepth,
+		niceLen:    preset.niceLen,
+		strategy:   preset.strategy,
+	}
+}
+
+// Option configures a Writer. Options are applied in order by NewWriter.
+type Option func(*config) error
+
+// WithMinMatch sets the minimum match length for the LZ77 stage, from 1 to MaxMatchLength.
+func WithMinMatch(n int) Option {
+	return func(c *config) error {
+		if n < 1 || n > MaxMatchLength {
+			return fmt.Errorf("lzhuff: min-match %d is outside the range 1 to %d", n, MaxMatchLength)
+		}
+		c.minMatch = n
+		return nil
+	}
+}
+
+// WithMaxMatch sets the maximum match length for the LZ77 stage, from 1 to MaxMatchLength.
+// Lengths are coded with a bucket symbol and extra bits, so matches longer than 255 bytes cost
+// only a few extra bits.
+func WithMaxMatch(n int) Option {
+	return func(c *config) error {
+		if n < 1 || n > MaxMatchLength {
+			return fmt.Errorf("lzhuff: max-match %d is outside the range 1 to %d", n, MaxMatchLength)
+		}
+		c.maxMatch = n
+		return nil
+	}
+}
+
+// WithSearchSize sets the size of the LZ77 search window, from 0 to MaxSearchSize bytes.
+// A window of 0 bytes disables matching. The Writer and the Reader keep the window in memory.
+// When this option is not given, the size is taken from the compression level.
+func WithSearchSize(n int) Option {
+	return func(c *config) error {
+		if n < 0 || n > MaxSearchSize {
+			return fmt.Errorf("lzhuff: search size %d is outside the range 0 to %d", n, MaxSearchSize)
+		}
+		c.searchSize = n
+		return nil
+	}
+}
+
+// WithChainDepth limits the number of earlier positions the match finder compares against
+// at every input position. Lower values compress faster but may find shorter matches.
+// A depth of 0 compares against every candidate in the search window. When this option is not
+// given, the depth is taken from the compression level.
+func WithChainDepth(n int) Option {
+	return func(c *config) error {
+		if n < 0 {
+			return fmt.Errorf("lzhuff: chain depth %d is negative", n)
+		}
+		c.chainDepth = n
+		return nil
+	}
+}
+
+// WithContentSize announces the length of the uncompressed data, so it can be recorded in the
+// header of a stream spanning several blocks. Close fails with ErrSizeMismatch if a different
+// number of bytes was written.
+func WithContentSize(n int64) Option {
+	return func(c *config) error {
+		if n < 0 {
+			return fmt.Errorf("lzhuff: content size %d is negative", n)
+		}
+		c.contentSize = n
+		return nil
+	}
+}
+
+// WithBlockSize sets the length of the uncompressed data compressed together as one block.
+// Every block gets its own Huffman code table unless reusing the table of the previous block is
+// smaller, so shorter blocks adapt faster to shifting statistics at the cost of more tables.
+// The Writer keeps one block and the search window in memory.
+func WithBlockSize(n int) Option {
+	return func(c *config) error {
+		if n < 1 || n > maxBlockSize {
+			return fmt.Errorf("lzhuff: block size %d is outside the range 1 to %d", n, maxBlockSize)
+		}
+		c.blockSize = n
+		return nil
+	}
+}
+
+// WithMaxCodeBits limits the length of every Huffman code to n bits. Skewed statistics can make
+// an unlimited Huffman code very deep; when the limit is exceeded, the code is rebuilt with the
+// package-merge algorithm, which finds the best code within the limit.
+func WithMaxCodeBits(n int) Option {
+	return func(c *config) error {
+		if n < minCodeBits || n > maxCodeBits {
+			return fmt.Errorf("lzhuff: maximum code length %d is outside the range %d to %d", n, minCodeBits, maxCodeBits)
+		}
+		c.maxCodeBits = n
+		return nil
+	}
+}
+
+// WithCoder selects the entropy coder of the blocks. The coder is recorded in the header, so the
+// Reader needs no option to decode the stream. When this option is not given, the coder is taken
+// from the compression level.
+func WithCoder(coder Coder) Option {
+	return func(c *config) error {
+		if _, ok := coderNames[coder]; !ok {
+			return fmt.Errorf("lzhuff: unknown coder %d", byte(coder))
+		}
+		c.coder, c.coderSet = coder, true
+		return nil
+	}
+}
+
+// WithLiteralContext enables order-1 literal modeling: the literal/length symbols are coded with
+// a separate code or model for every class of the byte before them (whitespace, letter, digit,
+// other). It helps text and structured data, at the cost of more tables per block with Huffman
+// and tANS coding. The mode is recorded in every block header. When this option is not given, the
+// mode is taken from the compression level.
+func WithLiteralContext(enabled bool) Option {
+	return func(c *config) error {
+		c.literalCtx, c.literalCtxSet = enabled, true
+		return nil
+	}
+}
+
+// WithGraphviz makes the Writer dump a Graphviz representation of its Huffman tree to w.
+func WithGraphviz(w io.Writer) Option {
+	return func(c *config) error {
+		c.graphviz = w
+		return nil
+	}
+}
+
+// WithLZTrace makes the Writer dump the textual LZ77 representation of its input to w.
+func WithLZTrace(w io.Writer) Option {
+	return func(c *config) error {
+		c.lzTrace = w
+		return nil
+	}
+}
+
+// WithLogger makes the Writer report its settings, the ratio of pointers of every block and the
+// input size to l. Without it the package logs nothing.
+func WithLogger(l *log.Logger) Option {
+	return func(c *config) error {
+		c.logger = l
+		return nil
+	}
+}
+
+// validate reports whether the combination of settings in c is usable.
+func (c *config) validate() error {
+	if c.minMatch > c.maxMatch {
+		return fmt.Errorf("lzhuff: min-match %d is larger than max-match %d", c.minMatch, c.maxMatch)
+	}
+	return nil
+}
@@ -0,0 +1,686 @@
+// lzhuff_test.go
+// Package lzhuff contains end-to-end tests for the Writer and Reader types.
+// These tests verify that data compressed with a Writer is restored exactly by a Reader.
+
+package lzhuff
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTrip compresses input with the given options and decompresses the result.
+func roundTrip(t *testing.T, input []byte, opts ...Option) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed, opts...)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	if _, err := zw.Write(input); err != nil {
+		t.Fatalf("Writer.Write() error = %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+
+	zr, err := NewReader(&compressed)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Reader.Read() error = %v", err)
+	}
+	return got
+}
+
+// Test_RoundTrip tests that the Writer and Reader restore the original input.
+func Test_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		opts  []Option
+	}{
+		{
+			name:  "Short text",
+			input: []byte("abcd abcd ghij abcd"),
+		},
+		{
+			name:  "Repetitive text",
+			input: []byte(strings.Repeat("the quick brown fox jumps over the lazy dog. ", 200)),
+		},
+		{
+			name:  "Custom parameters",
+			input: []byte(strings.Repeat("XXXabXXXcdXXXijXXX", 50)),
+			opts:  []Option{WithMinMatch(3), WithMaxMatch(16), WithSearchSize(64)},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			got := roundTrip(t, tt.input, tt.opts...)
+			if !bytes.Equal(got, tt.input) {
+				t.Errorf("round trip = %q; want %q", got, tt.input)
+			}
+		})
+	}
+}
+
+// Test_NewWriterRejectsInvalidOptions tests that NewWriter validates its options.
+func Test_NewWriterRejectsInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "min-match > max-match", opts: []Option{WithMinMatch(10), WithMaxMatch(5)}},
+		{name: "Zero min-match", opts: []Option{WithMinMatch(0)}},
+		{name: "max-match above range", opts: []Option{WithMaxMatch(MaxMatchLength + 1)}},
+		{name: "Negative search size", opts: []Option{WithSearchSize(-1)}},
+		{name: "Search size above range", opts: []Option{WithSearchSize(MaxSearchSize + 1)}},
+		{name: "Negative chain depth", opts: []Option{WithChainDepth(-1)}},
+		{name: "Negative content size", opts: []Option{WithContentSize(-1)}},
+		{name: "Zero block size", opts: []Option{WithBlockSize(0)}},
+		{name: "Block size above range", opts: []Option{WithBlockSize(maxBlockSize + 1)}},
+		{name: "Code length below range", opts: []Option{WithMaxCodeBits(minCodeBits - 1)}},
+		{name: "Code length above range", opts: []Option{WithMaxCodeBits(maxCodeBits + 1)}},
+		{name: "Level below range", opts: []Option{WithLevel(MinLevel - 1)}},
+		{name: "Level above range", opts: []Option{WithLevel(MaxLevel + 1)}},
+		{name: "Unknown coder", opts: []Option{WithCoder(Coder(200))}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewWriter(io.Discard, tt.opts...); err == nil {
+			t.Errorf("NewWriter() with %s returned no error", tt.name)
+		}
+	}
+}
+
+// Test_LargeWindow tests that matches thousands of bytes long, reaching back further than 64 KiB,
+// round-trip and are found across blocks.
+func Test_LargeWindow(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	chunk := make([]byte, 300000)
+	rng.Read(chunk)
+	input := append(bytes.Clone(chunk), chunk...)
+
+	for _, level := range []int{MinLevel, DefaultLevel, MaxLevel} {
+		// Huffman coding is kept at every level, so the limit below measures the pointers.
+		opts := []Option{WithLevel(level), WithSearchSize(1 << 20), WithMaxMatch(MaxMatchLength), WithBlockSize(100000), WithCoder(CoderHuffman)}
+		var compressed bytes.Buffer
+		zw, err := NewWriter(&compressed, opts...)
+		if err != nil {
+			t.Fatalf("NewWriter() error = %v", err)
+		}
+		zw.Write(input)
+		if err := zw.Close(); err != nil {
+			t.Fatalf("level %d: Writer.Close() error = %v", level, err)
+		}
+		// The random chunk does not compress, but its repetition must take a few bytes per
+		// pointer.
+		if limit := len(chunk) + len(chunk)/100; compressed.Len() > limit {
+			t.Errorf("level %d: output is %d bytes; want at most %d", level, compressed.Len(), limit)
+		}
+
+		if got := roundTrip(t, input, opts...); !bytes.Equal(got, input) {
+			t.Errorf("level %d: round trip does not restore the input", level)
+		}
+	}
+}
+
+// compressedSize returns the length of input compressed with the given options.
+func compressedSize(t *testing.T, input []byte, opts ...Option) int {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed, opts...)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	zw.Write(input)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	return compressed.Len()
+}
+
+// Test_MaxLevelLongRun tests that the highest level compresses a long run, which matches itself at
+// the maximum length at every position, in linear time.
+func Test_MaxLevelLongRun(t *testing.T) {
+	input := make([]byte, 1<<20)
+	begin := time.Now()
+	if got := roundTrip(t, input, WithLevel(MaxLevel)); !bytes.Equal(got, input) {
+		t.Fatal("round trip does not restore the input")
+	}
+	// Pricing every length at every position takes over ten seconds.
+	if elapsed := time.Since(begin); elapsed > 3*time.Second {
+		t.Errorf("round trip took %v; want at most 3s", elapsed)
+	}
+}
+
+// Test_Coders tests that every entropy coder round-trips single and multiple blocks, that the
+// coder is recorded in the header, and that the range and tANS coders beat Huffman coding on
+// skewed literals.
+func Test_Coders(t *testing.T) {
+	for _, coder := range []Coder{CoderHuffman, CoderRange, CoderFSE} {
+		for name, input := range testCorpus() {
+			for _, blockSize := range []int{4096, DefaultBlockSize} {
+				opts := []Option{WithCoder(coder), WithBlockSize(blockSize)}
+				if got := roundTrip(t, input, opts...); !bytes.Equal(got, input) {
+					t.Errorf("%v coder, %s, %d-byte blocks: round trip does not restore the input", coder, name, blockSize)
+				}
+			}
+		}
+
+		var compressed bytes.Buffer
+		zw, err := NewWriter(&compressed, WithCoder(coder))
+		if err != nil {
+			t.Fatalf("NewWriter() error = %v", err)
+		}
+		zw.Write(testCorpus()["Words"])
+		zw.Close()
+		zr, err := NewReader(bytes.NewReader(compressed.Bytes()[:compressed.Len()-20]))
+		if err != nil {
+			t.Fatalf("NewReader() error = %v", err)
+		}
+		if zr.Header().Coder != coder {
+			t.Errorf("Header().Coder = %v; want %v", zr.Header().Coder, coder)
+		}
+		if _, err := io.ReadAll(zr); !errors.Is(err, ErrTruncatedStream) {
+			t.Errorf("%v coder: Reader.Read() error = %v; want %v", coder, err, ErrTruncatedStream)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(18))
+	skewed := make([]byte, 100000)
+	for i := range skewed {
+		skewed[i] = 'a'
+		if rng.Intn(100) < 3 {
+			skewed[i] = byte('b' + rng.Intn(4))
+		}
+	}
+	// Without matches, Huffman codes spend at least a bit on every literal.
+	huffman := compressedSize(t, skewed, WithCoder(CoderHuffman), WithSearchSize(0))
+	for _, coder := range []Coder{CoderRange, CoderFSE} {
+		if size := compressedSize(t, skewed, WithCoder(coder), WithSearchSize(0)); size >= huffman/2 {
+			t.Errorf("%v coder output is %d bytes; Huffman output is %d bytes", coder, size, huffman)
+		}
+	}
+}
+
+// Test_RangeCoderGain tests that the range coder's adaptive model codes skewed literals in less
+// space than Huffman codes fitted to every block, and that it loses nothing on uniform ones.
+func Test_RangeCoderGain(t *testing.T) {
+	rng := rand.New(rand.NewSource(18))
+	geometric := make([]byte, 100000)
+	for i := range geometric {
+		geometric[i] = 'a'
+		for geometric[i] < 'z' && rng.Intn(3) > 0 {
+			geometric[i]++
+		}
+	}
+	random := make([]byte, 75000)
+	rng.Read(random)
+
+	tests := []struct {
+		name       string
+		input      []byte
+		searchSize int
+		gain       int // Minimum size reduction over Huffman codes, in percent.
+	}{
+		{name: "Geometric literals", input: geometric, searchSize: 0, gain: 1},
+		{name: "Words", input: testCorpus()["Words"], searchSize: DefaultSearchSize, gain: 4},
+		{name: "Base64", input: []byte(base64.StdEncoding.EncodeToString(random)), searchSize: 0, gain: 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			opts := []Option{WithSearchSize(tt.searchSize), WithLiteralContext(false)}
+			huffman := compressedSize(t, tt.input, append(opts, WithCoder(CoderHuffman))...)
+			size := compressedSize(t, tt.input, append(opts, WithCoder(CoderRange))...)
+			if size*100 > huffman*(100-tt.gain) {
+				t.Errorf("range coder output is %d bytes; want at most %d%% of the %d-byte Huffman output", size, 100-tt.gain, huffman)
+			}
+		})
+	}
+}
+
+// Test_LiteralContext tests that every entropy coder round-trips with literal contexts, that the
+// mode is recorded in the block header, and that it shrinks text coded without matches.
+func Test_LiteralContext(t *testing.T) {
+	for _, coder := range []Coder{CoderHuffman, CoderRange, CoderFSE} {
+		for name, input := range testCorpus() {
+			for _, blockSize := range []int{4096, DefaultBlockSize} {
+				opts := []Option{WithCoder(coder), WithBlockSize(blockSize), WithLiteralContext(true)}
+				if got := roundTrip(t, input, opts...); !bytes.Equal(got, input) {
+					t.Errorf("%v coder, %s, %d-byte blocks: round trip does not restore the input", coder, name, blockSize)
+				}
+			}
+		}
+
+		var compressed bytes.Buffer
+		zw, err := NewWriter(&compressed, WithCoder(coder), WithLiteralContext(true))
+		if err != nil {
+			t.Fatalf("NewWriter() error = %v", err)
+		}
+		zw.Write(testCorpus()["Words"])
+		zw.Close()
+		if bh, err := parseBlockHeader(compressed.Bytes()[headerSize:]); err != nil || !bh.literalCtx {
+			t.Errorf("%v coder: block header = %+v, %v; want literal contexts", coder, bh, err)
+		}
+
+		words := testCorpus()["Words"]
+		plain := compressedSize(t, words, WithCoder(coder), WithSearchSize(0), WithLiteralContext(false))
+		contextual := compressedSize(t, words, WithCoder(coder), WithSearchSize(0), WithLiteralContext(true))
+		if contextual >= plain {
+			t.Errorf("%v coder: output with literal contexts is %d bytes; without, %d bytes", coder, contextual, plain)
+		}
+	}
+}
+
+// Test_Levels tests that every compression level round-trips and that the highest level
+// compresses at least as well as the lowest one.
+func Test_Levels(t *testing.T) {
+	input := testCorpus()["Words"]
+	sizes := make(map[int]int)
+	for level := MinLevel; level <= MaxLevel; level++ {
+		var compressed bytes.Buffer
+		zw, err := NewWriter(&compressed, WithLevel(level))
+		if err != nil {
+			t.Fatalf("NewWriter() error = %v", err)
+		}
+		zw.Write(input)
+		if err := zw.Close(); err != nil {
+			t.Fatalf("level %d: Writer.Close() error = %v", level, err)
+		}
+		sizes[level] = compressed.Len()
+
+		if got := roundTrip(t, input, WithLevel(level)); !bytes.Equal(got, input) {
+			t.Errorf("level %d: round trip does not restore the input", level)
+		}
+	}
+	if sizes[MaxLevel] > sizes[MinLevel] {
+		t.Errorf("level %d output is %d bytes; level %d output is %d bytes", MaxLevel, sizes[MaxLevel], MinLevel, sizes[MinLevel])
+	}
+}
+
+// Test_LevelPresets tests that the level chooses the search window, the coder and the literal
+// contexts recorded in the stream, unless options set them, whatever their order.
+func Test_LevelPresets(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           []Option
+		wantSearchSize uint32
+		wantCoder      Coder
+		wantCtx        bool
+	}{
+		{name: "Default level", wantSearchSize: DefaultSearchSize, wantCoder: CoderHuffman, wantCtx: true},
+		{name: "Fastest level", opts: []Option{WithLevel(MinLevel)}, wantSearchSize: 1 << 16, wantCoder: CoderHuffman},
+		{name: "Level 7", opts: []Option{WithLevel(7)}, wantSearchSize: 1 << 20, wantCoder: CoderFSE, wantCtx: true},
+		{name: "Best level", opts: []Option{WithLevel(MaxLevel)}, wantSearchSize: 1 << 22, wantCoder: CoderRange, wantCtx: true},
+		{
+			name:           "Options before the level",
+			opts:           []Option{WithSearchSize(4096), WithCoder(CoderHuffman), WithLiteralContext(false), WithLevel(MaxLevel)},
+			wantSearchSize: 4096,
+			wantCoder:      CoderHuffman,
+		},
+		{
+			name:           "Options after the level",
+			opts:           []Option{WithLevel(MinLevel), WithSearchSize(MaxSearchSize), WithCoder(CoderRange), WithLiteralContext(true)},
+			wantSearchSize: MaxSearchSize,
+			wantCoder:      CoderRange,
+			wantCtx:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			var compressed bytes.Buffer
+			zw, err := NewWriter(&compressed, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewWriter() error = %v", err)
+			}
+			zw.Write([]byte(strings.Repeat("preset ", 100)))
+			if err := zw.Close(); err != nil {
+				t.Fatalf("Writer.Close() error = %v", err)
+			}
+			zr, err := NewReader(bytes.NewReader(compressed.Bytes()))
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			if h := zr.Header(); h.SearchSize != tt.wantSearchSize || h.Coder != tt.wantCoder {
+				t.Errorf("Header() = %+v; want search size %d and coder %v", h, tt.wantSearchSize, tt.wantCoder)
+			}
+			if bh, err := parseBlockHeader(compressed.Bytes()[headerSize:]); err != nil || bh.literalCtx != tt.wantCtx {
+				t.Errorf("block header = %+v, %v; want literal contexts %v", bh, err, tt.wantCtx)
+			}
+		})
+	}
+}
+
+// Test_ReaderErrors tests that malformed input produces the matching sentinel error.
+func Test_ReaderErrors(t *testing.T) {
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	zw.Write([]byte(strings.Repeat("abcdefgh", 100)))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{
+			name:    "Empty stream",
+			input:   []byte{},
+			wantErr: ErrTruncatedStream,
+		},
+		{
+			name:    "Stream cut inside the header",
+			input:   compressed.Bytes()[:headerSize-1],
+			wantErr: ErrTruncatedStream,
+		},
+		{
+			name:    "Stream cut inside the code table",
+			input:   compressed.Bytes()[:headerSize+3],
+			wantErr: ErrTruncatedStream,
+		},
+		{
+			name:    "Stream missing its last byte",
+			input:   compressed.Bytes()[:compressed.Len()-1],
+			wantErr: ErrTruncatedStream,
+		},
+		{
+			name:    "Unknown block flags",
+			input:   append(append(bytes.Clone(compressed.Bytes()[:headerSize]), 0x80), compressed.Bytes()[headerSize+1:]...),
+			wantErr: ErrCorruptStream,
+		},
+		{
+			name:    "First block reuses a table",
+			input:   append(append(bytes.Clone(compressed.Bytes()[:headerSize]), blockLast|blockReuseTable), compressed.Bytes()[headerSize+1:]...),
+			wantErr: ErrCorruptTable,
+		},
+		{
+			name:    "Block longer than its header says",
+			input:   withBlockSize(compressed.Bytes(), 100),
+			wantErr: ErrSizeMismatch,
+		},
+		{
+			name:    "Block shorter than its header says",
+			input:   withBlockSize(compressed.Bytes(), 1000),
+			wantErr: ErrSizeMismatch,
+		},
+		{
+			name:    "Search size above range",
+			input:   headerWithSearchSize(MaxSearchSize + 1),
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "Wrong magic bytes",
+			input:   append([]byte("ZIP!"), compressed.Bytes()[len(magic):]...),
+			wantErr: ErrInvalidHeader,
+		},
+		{
+			name:    "Unknown version",
+			input:   append([]byte(magic+"\xff"), compressed.Bytes()[len(magic)+1:]...),
+			wantErr: ErrUnsupportedVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			zr, err := NewReader(bytes.NewReader(tt.input))
+			if err == nil {
+				_, err = io.ReadAll(zr)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Reader.Read() error = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// headerWithSearchSize returns an intact stream header announcing the given search size.
+func headerWithSearchSize(size uint32) []byte {
+	var buf bytes.Buffer
+	writeHeader(&buf, Header{Version: formatVersion, SearchSize: size})
+	return buf.Bytes()
+}
+
+// withBlockSize returns a copy of the stream whose first block header records size.
+func withBlockSize(stream []byte, size uint32) []byte {
+	stream = bytes.Clone(stream)
+	binary.BigEndian.PutUint32(stream[headerSize+1:], size)
+	return stream
+}
+
+// Test_ReaderWriteTo tests that WriteTo, which io.Copy prefers over Read, streams every block and
+// reports the errors Read reports.
+func Test_ReaderWriteTo(t *testing.T) {
+	input := testCorpus()["Words"]
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed, WithBlockSize(4096))
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	zw.Write(input)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+
+	zr, err := NewReader(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	var got bytes.Buffer
+	if n, err := zr.WriteTo(&got); err != nil || n != int64(len(input)) {
+		t.Fatalf("Reader.WriteTo() = %d, %v; want %d, nil", n, err, len(input))
+	}
+	if !bytes.Equal(got.Bytes(), input) {
+		t.Errorf("Reader.WriteTo() does not restore the input")
+	}
+
+	zr, err = NewReader(bytes.NewReader(compressed.Bytes()[:compressed.Len()-1]))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if _, err := zr.WriteTo(io.Discard); !errors.Is(err, ErrTruncatedStream) {
+		t.Errorf("Reader.WriteTo() error = %v; want %v", err, ErrTruncatedStream)
+	}
+}
+
+// Test_ReaderDetectsBitFlips tests that flipping any single bit of a compressed stream never
+// silently produces different data. Only the padding bits before the trailer may be flipped
+// without an error, since they do not affect the decoded data.
+func Test_ReaderDetectsBitFlips(t *testing.T) {
+	input := []byte(strings.Repeat("flip a bit, catch a bit. ", 8))
+	var compressed bytes.Buffer
+	zw, err := NewWriter(&compressed)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	zw.Write(input)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+
+	for bit := 0; bit < compressed.Len()*8; bit++ {
+		damaged := bytes.Clone(compressed.Bytes())
+		damaged[bit/8] ^= 1 << (bit % 8)
+
+		var got []byte
+		zr, err := NewReader(bytes.NewReader(damaged))
+		if err == nil {
+			got, err = io.ReadAll(zr)
+		}
+		if err == nil && !bytes.Equal(got, input) {
+			t.Fatalf("bit %d flipped: decompression returned different data without an error", bit)
+		}
+		// Damage to the header or to the checksum in the trailer must be reported as a checksum
+		// mismatch, and damage to the length in the trailer as a size mismatch.
+		trailerStart := (compressed.Len() - trailerSize) * 8
+		switch {
+		case bit >= len(magic)*8+16 && bit < headerSize*8, bit >= trailerStart && bit < trailerStart+32:
+			if !errors.Is(err, ErrChecksum) {
+				t.Errorf("bit %d flipped: error = %v; want %v", bit, err, ErrChecksum)
+			}
+		case bit >= trailerStart+32:
+			if !errors.Is(err, ErrSizeMismatch) {
+				t.Errorf("bit %d flipped: error = %v; want %v", bit, err, ErrSizeMismatch)
+			}
+		}
+	}
+}
+
+// Test_RoundTripRandomSizes tests that decompression is exact for many input sizes.
+// Inputs drawn from small alphabets produce short, zero-heavy codes, which would expose
+// trailing padding bits being decoded as data.
+func Test_RoundTripRandomSizes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, alphabet := range []int{1, 2, 3, 16, 256} {
+		for size := 0; size <= 300; size++ {
+			input := make([]byte, size)
+			for i := range input {
+				input[i] = byte(rng.Intn(alphabet))
+			}
+
+			got := roundTrip(t, input, WithMinMatch(3))
+			if !bytes.Equal(got, input) {
+				t.Fatalf("alphabet %d, size %d: round trip = %v; want %v", alphabet, size, got, input)
+			}
+		}
+	}
+}
+
+// Test_Streaming tests that input spanning several blocks is compressed through a pipe in small
+// writes and restored exactly, and that the header records the length only when it is known.
+func Test_Streaming(t *testing.T) {
+	input := bytes.Repeat(testCorpus()["Words"], 2*DefaultBlockSize/20000+10)
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantSize bool
+	}{
+		{name: "Unknown size", opts: []Option{WithLevel(MinLevel)}},
+		{name: "Announced size", opts: []Option{WithLevel(MinLevel), WithContentSize(int64(len(input)))}, wantSize: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			pr, pw := io.Pipe()
+			go func() {
+				zw, err := NewWriter(pw, tt.opts...)
+				if err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				for rest := input; len(rest) > 0; {
+					n := min(len(rest), 4000)
+					if _, err := zw.Write(rest[:n]); err != nil {
+						pw.CloseWithError(err)
+						return
+					}
+					rest = rest[n:]
+				}
+				pw.CloseWithError(zw.Close())
+			}()
+
+			zr, err := NewReader(pr)
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			if got := zr.Header().Flags&FlagContentSize != 0; got != tt.wantSize {
+				t.Errorf("Header().Flags has FlagContentSize = %v; want %v", got, tt.wantSize)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reader.Read() error = %v", err)
+			}
+			if !bytes.Equal(got, input) {
+				t.Errorf("round trip of %d bytes returned %d different bytes", len(input), len(got))
+			}
+		})
+	}
+}
+
+// Test_WriterContentSizeMismatch tests that Close reports input shorter than announced.
+func Test_WriterContentSizeMismatch(t *testing.T) {
+	zw, err := NewWriter(io.Discard, WithContentSize(10))
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	zw.Write([]byte("short"))
+	if err := zw.Close(); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("Writer.Close() error = %v; want %v", err, ErrSizeMismatch)
+	}
+}
+
+// Test_BlockTables tests that input with shifting statistics round-trips through many small
+// blocks, and that blocks only reuse the previous code table when it is smaller.
+func Test_BlockTables(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	binary := make([]byte, 30000)
+	rng.Read(binary)
+	input := append(binary, testCorpus()["Words"]...)
+
+	for _, size := range []int{1000, 4096, 65536} {
+		if got := roundTrip(t, input, WithBlockSize(size)); !bytes.Equal(got, input) {
+			t.Errorf("block size %d: round trip does not restore the input", size)
+		}
+	}
+
+	cfg, err := newConfig(defaultConfig(), nil)
+	if err != nil {
+		t.Fatalf("newConfig() error = %v", err)
+	}
+	text := parseValues(testCorpus()["Words"], 0, cfg.lzParams())
+	textTables := constructHuffmanTrees(text, nil).codeTables(DefaultMaxCodeBits)
+	random := parseValues(binary[:3000], 0, cfg.lzParams())
+	randomTables := constructHuffmanTrees(random, nil).codeTables(DefaultMaxCodeBits)
+	tests := []struct {
+		name      string
+		values    []Value
+		fresh     CodeTables
+		prev      *CodeTables
+		wantReuse bool
+	}{
+		{name: "First block", values: text, fresh: textTables, prev: nil, wantReuse: false},
+		{name: "Same statistics", values: text, fresh: textTables, prev: &textTables, wantReuse: true},
+		{name: "Missing codes", values: random, fresh: randomTables, prev: &textTables, wantReuse: false},
+		{name: "Unfitting table", values: text, fresh: textTables, prev: &randomTables, wantReuse: false},
+	}
+
+	for _, tt := range tests {
+		if _, reuse := selectCodeTables(tt.values, nil, tt.fresh, tt.prev); reuse != tt.wantReuse {
+			t.Errorf("%s: selectCodeTables() reuses the previous tables = %v; want %v", tt.name, reuse, tt.wantReuse)
+		}
+	}
+}
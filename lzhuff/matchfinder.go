@@ -0,0 +1,184 @@
+// matchfinder.go
+// Package lzhuff provides a hash-chain match finder for the LZ77 stage.
+// Every position of the input is inserted into a hash table keyed on its first bytes, and
+// positions sharing a bucket are linked into a chain from the newest to the oldest. Looking up
+// a match only visits the earlier positions whose leading bytes hash alike, instead of scanning
+// the whole search window.
+
+package lzhuff
+
+// hashBits is the number of bits of the hash table index.
+const hashBits = 15
+
+// maxHashLen is the largest number of leading bytes the hash is computed over.
+const maxHashLen = 4
+
+// matchFinder locates the longest earlier occurrence of the bytes at a position of its input.
+// Lookups insert every position before the one looked up, so positions become candidates
+// in increasing order.
+type matchFinder struct {
+	input      []byte  // The data being compressed.
+	minMatch   int     // Minimum match length worth reporting.
+	maxMatch   int     // Maximum match length.
+	window     int     // Maximum distance between a position and its match.
+	chainDepth int     // Maximum number of candidates visited per lookup; 0 means unlimited.
+	niceLen    int     // Match length that ends a lookup early; 0 means never.
+	hashLen    int     // Number of leading bytes the hash is computed over.
+	head       []int32 // Most recent position for every hash value, or -1.
+	prev       []int32 // Previous position with the same hash for every position, or -1.
+	next       int     // First position that has not been inserted yet.
+}
+
+// newMatchFinder creates a matchFinder over input.
+// Parameters:
+// - input: The data to find matches in.
+// - minMatch: The minimum length of a match to be reported.
+// - maxMatch: The maximum length of a match.
+// - window: The maximum distance between a position and its match.
+// - chainDepth: The maximum number of candidates visited per lookup, or 0 for no limit.
+// - niceLen: The match length that is good enough to end a lookup early, or 0 to never end early.
+func newMatchFinder(input []byte, minMatch, maxMatch, window, chainDepth, niceLen int) *matchFinder {
+	// The hash must not cover more bytes than the shortest acceptable match, or matches of
+	// exactly minMatch bytes could land in different buckets.
+	hashLen := min(max(minMatch, 1), maxHashLen)
+
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	return &matchFinder{
+		input:      input,
+		minMatch:   minMatch,
+		maxMatch:   maxMatch,
+		window:     window,
+		chainDepth: chainDepth,
+		niceLen:    niceLen,
+		hashLen:    hashLen,
+		head:       head,
+		prev:       make([]int32, len(input)),
+	}
+}
+
+// hash computes the hash table index of the hashLen bytes starting at pos.
+func (mf *matchFinder) hash(pos int) uint32 {
+	var key uint32
+	for _, b := range mf.input[pos : pos+mf.hashLen] {
+		key = key<<8 | uint32(b)
+	}
+	return (key * 2654435761) >> (32 - hashBits)
+}
+
+// advance inserts every position before pos into the hash chains so lookups can find them.
+// Positions too close to the end of the input to be hashed are skipped.
+func (mf *matchFinder) advance(pos int) {
+	for ; mf.next < pos; mf.next++ {
+		if mf.next+mf.hashLen > len(mf.input) {
+			continue
+		}
+		h := mf.hash(mf.next)
+		mf.prev[mf.next] = mf.head[h]
+		mf.head[h] = int32(mf.next)
+	}
+}
+
+// lookupLimit returns the longest match length possible at pos, or 0 if no match of at least
+// minMatch bytes can start there.
+func (mf *matchFinder) lookupLimit(pos int) int {
+	maxLen := min(mf.maxMatch, len(mf.input)-pos)
+	if maxLen < mf.minMatch || pos+mf.hashLen > len(mf.input) {
+		return 0
+	}
+	return maxLen
+}
+
+// find returns the longest match for the bytes at pos among the inserted positions within the
+// window. Ties are resolved in favor of the oldest candidate, unless a match of at least niceLen
+// bytes ends the search first. The match may overlap pos.
+// Returns:
+// - position: The start of the match, or 0 if none was found.
+// - length: The length of the match, or 0 if no match of at least minMatch bytes exists.
+func (mf *matchFinder) find(pos int) (int, int) {
+	mf.advance(pos)
+	maxLen := mf.lookupLimit(pos)
+	if maxLen == 0 {
+		return 0, 0
+	}
+
+	var (
+		bestPos int
+		bestLen int
+	)
+	windowStart := pos - mf.window
+	depth := 0
+	for cand := int(mf.head[mf.hash(pos)]); cand >= 0 && cand >= windowStart; cand = int(mf.prev[cand]) {
+		// Positions at or after pos may already be inserted by an earlier lookahead.
+		if cand >= pos {
+			continue
+		}
+		if mf.chainDepth > 0 && depth >= mf.chainDepth {
+			break
+		}
+		depth++
+
+		// Skip candidates that cannot reach the best length found so far.
+		if bestLen > 0 && mf.input[cand+bestLen-1] != mf.input[pos+bestLen-1] {
+			continue
+		}
+		length := 0
+		for length < maxLen && mf.input[cand+length] == mf.input[pos+length] {
+			length++
+		}
+		// The chain runs from newest to oldest, so >= keeps the oldest of equally long matches.
+		if length >= mf.minMatch && length > 0 && length >= bestLen {
+			bestPos, bestLen = cand, length
+			if mf.niceLen > 0 && bestLen >= mf.niceLen {
+				break
+			}
+		}
+	}
+	return bestPos, bestLen
+}
+
+// forEachMatch reports the matches for the bytes at pos that are longer than every match reported
+// before them, visiting the candidates from the nearest to the farthest. Every reported match has
+// at least minMatch bytes. The search ends at the chain depth or once the longest possible match
+// has been reported.
+// Parameters:
+// - pos: The position to find matches for.
+// - fn: Called with the start and length of every reported match.
+func (mf *matchFinder) forEachMatch(pos int, fn func(matchPos, length int)) {
+	mf.advance(pos)
+	maxLen := mf.lookupLimit(pos)
+	if maxLen == 0 {
+		return
+	}
+
+	bestLen := 0
+	windowStart := pos - mf.window
+	depth := 0
+	for cand := int(mf.head[mf.hash(pos)]); cand >= 0 && cand >= windowStart; cand = int(mf.prev[cand]) {
+		if cand >= pos {
+			continue
+		}
+		if mf.chainDepth > 0 && depth >= mf.chainDepth {
+			break
+		}
+		depth++
+
+		// Only candidates extending beyond the best length so far are of interest.
+		if bestLen > 0 && mf.input[cand+bestLen] != mf.input[pos+bestLen] {
+			continue
+		}
+		length := 0
+		for length < maxLen && mf.input[cand+length] == mf.input[pos+length] {
+			length++
+		}
+		if length > bestLen && length >= mf.minMatch {
+			bestLen = length
+			fn(cand, length)
+			if bestLen == maxLen {
+				return
+			}
+		}
+	}
+}
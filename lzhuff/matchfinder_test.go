@@ -0,0 +1,110 @@
+// matchfinder_test.go
+// Package lzhuff contains tests for the hash-chain match finder.
+// These tests compare the matchFinder with the brute-force getLongestMatchPosAndLen scan and
+// measure its speed on large inputs.
+
+package lzhuff
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// referenceBytesToValues is the brute-force greedy parser the matchFinder replaces.
+// It scans the whole search buffer with getLongestMatchPosAndLen at every position.
+func referenceBytesToValues(input []byte, minMatchLen, maxMatchLen byte, maxSearchBuffLen uint16) []Value {
+	values := make([]Value, 0, len(input))
+	for split := 0; split < len(input); split++ {
+		searchBuffStart := max(0, split-int(maxSearchBuffLen))
+		lookaheadBuffEnd := min(len(input), split+int(maxMatchLen))
+		matchPos, matchLen := getLongestMatchPosAndLen(
+			input[searchBuffStart:split],
+			input[split:lookaheadBuffEnd],
+			minMatchLen,
+		)
+		if split > int(minMatchLen) && matchLen > 0 {
+			values = append(values, NewValue(false, 0, uint16(matchLen), uint32(split-(matchPos+searchBuffStart))))
+			split += int(matchLen) - 1
+		} else {
+			values = append(values, NewValue(true, input[split], 1, 0))
+		}
+	}
+	return values
+}
+
+// testCorpus returns inputs with different statistics for comparing parsers.
+func testCorpus() map[string][]byte {
+	rng := rand.New(rand.NewSource(7))
+	random := make([]byte, 20000)
+	rng.Read(random)
+	smallAlphabet := make([]byte, 20000)
+	for i := range smallAlphabet {
+		smallAlphabet[i] = "ab"[rng.Intn(2)]
+	}
+	var words strings.Builder
+	vocabulary := strings.Fields("lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor")
+	for words.Len() < 20000 {
+		words.WriteString(vocabulary[rng.Intn(len(vocabulary))])
+		words.WriteByte(" \n"[rng.Intn(2)])
+	}
+
+	return map[string][]byte{
+		"Random bytes":   random,
+		"Small alphabet": smallAlphabet,
+		"Words":          []byte(words.String()),
+		"Single run":     bytes.Repeat([]byte{'X'}, 5000),
+	}
+}
+
+// Test_matchFinderMatchesReference tests that the hash-chain parser round-trips every input
+// and never needs more values than the brute-force parser.
+func Test_matchFinderMatchesReference(t *testing.T) {
+	for name, input := range testCorpus() {
+		input := input // Capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			got := BytesToValues(input, 4, 255, 4096)
+			want := referenceBytesToValues(input, 4, 255, 4096)
+			if len(got) > len(want) {
+				t.Errorf("BytesToValues() produced %d values; reference produced %d", len(got), len(want))
+			}
+
+			decoded, err := ValuesToBytes(got)
+			if err != nil {
+				t.Fatalf("ValuesToBytes() error = %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("ValuesToBytes(BytesToValues()) does not restore the input")
+			}
+		})
+	}
+}
+
+// Test_matchFinderChainDepth tests that a limited chain depth still produces a valid parse.
+func Test_matchFinderChainDepth(t *testing.T) {
+	input := testCorpus()["Words"]
+	for _, depth := range []int{1, 4, 32} {
+		values := parseValues(input, 0, lzParams{minMatch: 4, maxMatch: 255, searchSize: 4096, chainDepth: depth})
+		decoded, err := ValuesToBytes(values)
+		if err != nil {
+			t.Fatalf("depth %d: ValuesToBytes() error = %v", depth, err)
+		}
+		if !bytes.Equal(decoded, input) {
+			t.Errorf("depth %d: ValuesToBytes(parseValues()) does not restore the input", depth)
+		}
+	}
+}
+
+// Benchmark_BytesToValuesLarge benchmarks the hash-chain parser on a multi-megabyte text input.
+func Benchmark_BytesToValuesLarge(b *testing.B) {
+	input := bytes.Repeat(testCorpus()["Words"], 200)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer() // Reset the timer to exclude setup time
+
+	for n := 0; n < b.N; n++ {
+		Values = BytesToValues(input, 4, 255, 4096)
+	}
+}
@@ -0,0 +1,446 @@
+// parser.go
+// Package lzhuff provides the parsers of the LZ77 stage, which decide where to emit literals
+// and where to emit pointers. The greedy parser takes the longest match at every position, the
+// lazy parsers defer a match when a longer one starts a position or two later, and the optimal
+// parser minimizes the encoded size using the Huffman code lengths of a previous parse as prices,
+// following the recent distances along every path so repeat-offset symbols are priced too.
+
+package lzhuff
+
+import (
+	"math"
+)
+
+// parseStrategy selects how the LZ77 stage chooses between literals and matches.
+type parseStrategy int
+
+const (
+	parseGreedy  parseStrategy = iota // Take the longest match at every position.
+	parseLazy                         // Defer a match by one position if the next match is longer.
+	parseLazy2                        // Defer a match by up to two positions.
+	parseOptimal                      // Minimize the encoded size using code lengths as prices.
+)
+
+// optimalPasses is the number of optimal parsing passes. Each pass prices symbols with the code
+// lengths produced by the previous one.
+const optimalPasses = 2
+
+// optimalSegment is the number of positions the optimal parser plans at once. The matches of a
+// segment are looked up once and shared by every pass, and the buffers of the dynamic programming
+// hold one segment, so memory use does not grow with the block size.
+const optimalSegment = 1 << 16
+
+// optimalNiceLen is the niceLen of the optimal parser when the level sets none, lowered to the
+// maximum match length when that is shorter. Without it, every position a long match covers would
+// price every length up to the match and compare every candidate up to its full length, so runs
+// thousands of bytes long would take quadratic time.
+const optimalNiceLen = 1024
+
+// lzParams groups the settings of the LZ77 stage.
+type lzParams struct {
+	minMatch   int           // Minimum length of a match to be considered for compression.
+	maxMatch   int           // Maximum length of a match.
+	searchSize int           // Maximum distance between a position and its match.
+	chainDepth int           // Maximum number of hash chain candidates visited per position; 0 means unlimited.
+	niceLen    int           // Match length that ends the candidate search early; 0 means never.
+	strategy   parseStrategy // How literals and matches are chosen.
+}
+
+// newMatchFinder creates a matchFinder over input configured by p.
+func (p lzParams) newMatchFinder(input []byte) *matchFinder {
+	return newMatchFinder(input, p.minMatch, p.maxMatch, p.searchSize, p.chainDepth, p.niceLen)
+}
+
+// canPoint reports whether a pointer may start at pos. No pointer is emitted within the first
+// minMatch+1 bytes of the input.
+func (p lzParams) canPoint(pos int) bool {
+	return pos > p.minMatch
+}
+
+// preferRep returns the longest match at pos at one of the recent distances instead of the match
+// found at matchPos when it is at least as long, as its distance costs no extra bits.
+// Parameters:
+// - input: the history followed by the bytes being parsed.
+// - pos: the position of the match.
+// - reps: the recent distances at pos.
+// - matchPos, matchLen: the match found by the matchFinder, with a length of 0 for none.
+func (p lzParams) preferRep(input []byte, pos int, reps *repDistances, matchPos, matchLen int) (int, int) {
+	dist, length := reps.repMatch(input, pos, p.maxMatch, p.searchSize)
+	if length >= max(p.minMatch, 1) && length >= matchLen {
+		return pos - dist, length
+	}
+	return matchPos, matchLen
+}
+
+// parseValues converts buf[start:] into a slice of Value instances using LZ77 compression,
+// using the parser selected by p.strategy. The bytes before start are history that pointers
+// may refer to but that is not encoded again.
+// Parameters:
+// - buf: the history followed by the bytes to be compressed.
+// - start: the position in buf of the first byte to be compressed.
+// - p: the settings of the LZ77 stage.
+func parseValues(buf []byte, start int, p lzParams) []Value {
+	var values []Value
+	switch p.strategy {
+	case parseLazy:
+		values = lazyParse(buf, start, p, 1)
+	case parseLazy2:
+		values = lazyParse(buf, start, p, 2)
+	case parseOptimal:
+		values = optimalParse(buf, start, p)
+	default:
+		values = greedyParse(buf, start, p)
+	}
+	return values
+}
+
+// greedyParse takes the longest match reported by the matchFinder at every position of buf[start:],
+// or a match as long at one of the recent distances.
+func greedyParse(input []byte, start int, p lzParams) []Value {
+	mf := p.newMatchFinder(input)
+	values := make([]Value, 0, len(input)-start)
+	reps := newRepDistances()
+
+	for split := start; split < len(input); {
+		// Find the longest match for the bytes starting at split.
+		matchPos, matchLen := mf.find(split)
+
+		if p.canPoint(split) {
+			matchPos, matchLen = p.preferRep(input, split, &reps, matchPos, matchLen)
+		}
+		if p.canPoint(split) && matchLen > 0 {
+			// Create a pointer Value with the distance from the current position to the match.
+			values = append(values, NewValue(false, 0, uint16(matchLen), uint32(split-matchPos)))
+			reps.update(split - matchPos)
+			split += matchLen
+		} else {
+			// Create a literal Value.
+			values = append(values, NewValue(true, input[split], 1, 0))
+			split++
+		}
+	}
+	return values
+}
+
+// lazyParse works like greedyParse, but before taking a match it checks whether a longer match
+// starts up to lookahead positions later. If one does and it pays for the literals emitted in
+// between, the current match is dropped in favor of the later one.
+// Parameters:
+// - input: the history followed by the bytes to be compressed.
+// - start: the position in input of the first byte to be compressed.
+// - p: the settings of the LZ77 stage.
+// - lookahead: the number of later positions to check, 1 or 2.
+func lazyParse(input []byte, start int, p lzParams, lookahead int) []Value {
+	mf := p.newMatchFinder(input)
+	values := make([]Value, 0, len(input)-start)
+	reps := newRepDistances()
+
+	// findAt returns the longest match at pos, or no match where pointers are not allowed.
+	findAt := func(pos int) (int, int) {
+		if pos >= len(input) || !p.canPoint(pos) {
+			return 0, 0
+		}
+		matchPos, matchLen := mf.find(pos)
+		return p.preferRep(input, pos, &reps, matchPos, matchLen)
+	}
+
+	split := start
+	matchPos, matchLen := findAt(split)
+	for split < len(input) {
+		if matchLen == 0 {
+			values = append(values, NewValue(true, input[split], 1, 0))
+			split++
+			matchPos, matchLen = findAt(split)
+			continue
+		}
+
+		// Look for a longer match a little later, unless the current one is already good enough.
+		deferred := false
+		if p.niceLen == 0 || matchLen < p.niceLen {
+			for step := 1; step <= lookahead; step++ {
+				nextPos, nextLen := findAt(split + step)
+				// Deferring costs step literals, so the later match must be longer by at least step.
+				if nextLen > matchLen+step-1 {
+					for i := 0; i < step; i++ {
+						values = append(values, NewValue(true, input[split+i], 1, 0))
+					}
+					split += step
+					matchPos, matchLen = nextPos, nextLen
+					deferred = true
+					break
+				}
+			}
+		}
+		if deferred {
+			continue
+		}
+
+		values = append(values, NewValue(false, 0, uint16(matchLen), uint32(split-matchPos)))
+		reps.update(split - matchPos)
+		split += matchLen
+		matchPos, matchLen = findAt(split)
+	}
+	return values
+}
+
+// optimalParse chooses the sequence of literals and pointers with the smallest encoded size.
+// The block is planned one segment at a time. Symbol prices come from the Huffman code lengths of
+// a preceding parse: a greedy parse for the first segment, then the previous pass, and every
+// segment starts from the prices of the segment before it and from the recent distances left by
+// its parse.
+func optimalParse(input []byte, start int, p lzParams) []Value {
+	if p.niceLen == 0 {
+		p.niceLen = min(optimalNiceLen, p.maxMatch)
+	}
+	op := newOptimalParser(input, p)
+	values := make([]Value, 0, len(input)-start)
+	var prices *huffmanPrices
+	reps := newRepDistances()
+	for segStart := start; segStart < len(input); segStart += optimalSegment {
+		end := min(segStart+optimalSegment, len(input))
+		op.findMatches(segStart, end)
+		if prices == nil {
+			prices = newHuffmanPrices(op.greedy(segStart, end))
+		}
+		var segment []Value
+		var segReps repDistances
+		for pass := 0; pass < optimalPasses; pass++ {
+			segment, segReps = op.pass(segStart, end, prices, reps)
+			prices = newHuffmanPrices(segment)
+		}
+		values = append(values, segment...)
+		reps = segReps
+	}
+	return values
+}
+
+// optimalMatch is a match found for a position of the segment being planned.
+type optimalMatch struct {
+	dist   int32 // Distance back to the match.
+	length int32 // Length of the match, which may extend past the end of the segment.
+}
+
+// optimalParser holds the state of the optimal parser. Its buffers are sized to a segment and
+// reused by every segment and every pass.
+type optimalParser struct {
+	buf      []byte         // The history followed by the bytes being parsed.
+	p        lzParams       // Settings of the LZ77 stage.
+	mf       *matchFinder   // Match finder over buf, advanced one segment at a time.
+	skipTo   int            // Position before which no match is looked up, inside a long match.
+	skipDist int            // Distance of that long match.
+	matches  []optimalMatch // Matches of every position of the segment, in order of position.
+	first    []int          // Index in matches of the first match of every position, and the end.
+	skipped  []bool         // Whether every position of the segment lies inside a long match.
+	cost     []int          // Cheapest known price of encoding the segment up to every position.
+	stepLen  []int          // Length of the last step of that encoding; 1 with distance 0 is a literal.
+	stepDist []int          // Distance of the last step, or 0 for a literal.
+	reps     []repDistances // Recent distances after that encoding.
+}
+
+// newOptimalParser returns an optimalParser over buf.
+func newOptimalParser(buf []byte, p lzParams) *optimalParser {
+	n := min(len(buf), optimalSegment) + 1
+	return &optimalParser{
+		buf:      buf,
+		p:        p,
+		mf:       p.newMatchFinder(buf),
+		first:    make([]int, n),
+		skipped:  make([]bool, n),
+		cost:     make([]int, n),
+		stepLen:  make([]int, n),
+		stepDist: make([]int, n),
+		reps:     make([]repDistances, n),
+	}
+}
+
+// findMatches looks up the matches of every position from segStart to end once, for all passes.
+// The candidates are reported from the nearest to the farthest, each longer than the one before.
+// A match of at least niceLen bytes is taken as is, so the positions it covers are not looked up;
+// when it runs past the end of the segment, its rest is the only match of the next segment's start.
+func (op *optimalParser) findMatches(segStart, end int) {
+	op.matches = op.matches[:0]
+	for pos := segStart; pos < end; pos++ {
+		op.first[pos-segStart] = len(op.matches)
+		op.skipped[pos-segStart] = pos < op.skipTo
+		if pos == segStart && pos < op.skipTo {
+			op.matches = append(op.matches, optimalMatch{dist: int32(op.skipDist), length: int32(op.skipTo - pos)})
+		}
+		if pos < op.skipTo || !op.p.canPoint(pos) {
+			continue
+		}
+		longest, longestDist := 0, 0
+		op.mf.forEachMatch(pos, func(matchPos, length int) {
+			op.matches = append(op.matches, optimalMatch{dist: int32(pos - matchPos), length: int32(length)})
+			longest, longestDist = length, pos-matchPos
+		})
+		if op.p.niceLen > 0 && longest >= op.p.niceLen {
+			op.skipTo, op.skipDist = pos+longest, longestDist
+		}
+	}
+	op.first[end-segStart] = len(op.matches)
+}
+
+// greedy returns the greedy parse of the segment from segStart to end, which takes the longest
+// match found at every position.
+func (op *optimalParser) greedy(segStart, end int) []Value {
+	var values []Value
+	for pos := segStart; pos < end; {
+		i := pos - segStart
+		if ms := op.matches[op.first[i]:op.first[i+1]]; len(ms) > 0 {
+			m := ms[len(ms)-1]
+			length := min(int(m.length), end-pos)
+			values = append(values, NewValue(false, 0, uint16(length), uint32(m.dist)))
+			pos += length
+			continue
+		}
+		values = append(values, NewValue(true, op.buf[pos], 1, 0))
+		pos++
+	}
+	return values
+}
+
+// pass finds the cheapest parse of the segment from segStart to end under the given prices with
+// dynamic programming. For every position, in order, it relaxes the literal at that position, the
+// matches at the recent distances of the cheapest encoding reaching it and every match length
+// available there, then walks back from the end of the segment. A match at a recent distance is
+// priced at its repeat-offset symbol. Matches are cut at the end of the segment.
+// Parameters:
+// - segStart, end: The bounds of the segment in buf.
+// - prices: The price of every symbol.
+// - reps: The recent distances at segStart.
+// Returns:
+// - The parse of the segment.
+// - The recent distances at the end of the segment.
+func (op *optimalParser) pass(segStart, end int, prices *huffmanPrices, reps repDistances) ([]Value, repDistances) {
+	n := end - segStart
+	cost, stepLen, stepDist := op.cost[:n+1], op.stepLen[:n+1], op.stepDist[:n+1]
+	cost[0] = 0
+	for i := 1; i <= n; i++ {
+		cost[i] = math.MaxInt
+	}
+	op.reps[0] = reps
+
+	// relax records the match of length l at dist from i to i+l if it is the cheapest way there.
+	relax := func(i, l, dist, price int, reps *repDistances) {
+		if c := cost[i] + price; c < cost[i+l] {
+			cost[i+l], stepLen[i+l], stepDist[i+l] = c, l, dist
+			op.reps[i+l] = *reps
+			op.reps[i+l].update(dist)
+		}
+	}
+
+	minLen := max(op.p.minMatch, 1)
+	for i := 0; i < n; i++ {
+		pos := segStart + i
+		if c := cost[i] + prices.literal(op.buf[pos]); c < cost[i+1] {
+			cost[i+1], stepLen[i+1], stepDist[i+1] = c, 1, 0
+			op.reps[i+1] = op.reps[i]
+		}
+		reps := &op.reps[i]
+
+		if !op.skipped[i] && op.p.canPoint(pos) {
+			maxLen := min(op.p.maxMatch, n-i)
+			for k, dist := range reps {
+				if dist > pos || dist > op.p.searchSize {
+					continue
+				}
+				for l := 1; l <= maxLen && op.buf[pos+l-1] == op.buf[pos+l-1-dist]; l++ {
+					if l >= minLen {
+						relax(i, l, dist, prices.rep(k, l), reps)
+					}
+				}
+			}
+		}
+
+		longest := 0
+		for _, m := range op.matches[op.first[i]:op.first[i+1]] {
+			// Each candidate is longer than the previous one; price the lengths it adds.
+			dist := int(m.dist)
+			k := reps.index(dist)
+			for l := max(longest+1, minLen); l <= min(int(m.length), n-i); l++ {
+				price := 0
+				if k >= 0 {
+					price = prices.rep(k, l)
+				} else {
+					price = prices.match(dist, l)
+				}
+				relax(i, l, dist, price, reps)
+			}
+			longest = int(m.length)
+		}
+	}
+
+	// Walk back from the end of the segment, then reverse the steps into Values.
+	values := make([]Value, 0, n/2)
+	for i := n; i > 0; i -= stepLen[i] {
+		if stepDist[i] == 0 {
+			values = append(values, NewValue(true, op.buf[segStart+i-1], 1, 0))
+		} else {
+			values = append(values, NewValue(false, 0, uint16(stepLen[i]), uint32(stepDist[i])))
+		}
+	}
+	for l, r := 0, len(values)-1; l < r; l, r = l+1, r-1 {
+		values[l], values[r] = values[r], values[l]
+	}
+	return values, op.reps[n]
+}
+
+// huffmanPrices estimates the encoded size in bits of literals and pointers from the Huffman
+// code lengths of a parse.
+type huffmanPrices struct {
+	literalBits  []int // Code length of every literal byte.
+	lengthBits   []int // Code length and extra bits of every match length, indexed by length.
+	distanceBits []int // Code length of every symbol of the distance alphabet.
+}
+
+// newHuffmanPrices builds the prices of the Huffman codes constructed for values, limited to the
+// default maximum code length. Symbols absent from values are priced one bit above the longest
+// code of their alphabet.
+func newHuffmanPrices(values []Value) *huffmanPrices {
+	codes := constructHuffmanTrees(values, nil).codeTables(DefaultMaxCodeBits)
+	prices := &huffmanPrices{
+		distanceBits: symbolPrices(codes.distances),
+	}
+	litLenBits := symbolPrices(codes.litLen[0])
+	prices.literalBits = litLenBits[:litLenEOB]
+	prices.lengthBits = make([]int, lengthCode.last+1)
+	for length := lengthCode.first; length <= lengthCode.last; length++ {
+		sym, _, extraBits := lengthSymbol(length)
+		prices.lengthBits[length] = litLenBits[sym] + int(extraBits)
+	}
+	return prices
+}
+
+// symbolPrices returns the code length of every symbol of table, pricing symbols without a code
+// one bit above the longest code.
+func symbolPrices(table CodeTable) []int {
+	longest := 0
+	for _, code := range table {
+		longest = max(longest, int(code.bits))
+	}
+	prices := make([]int, len(table))
+	for sym, code := range table {
+		prices[sym] = longest + 1
+		if code.bits != 0 {
+			prices[sym] = int(code.bits)
+		}
+	}
+	return prices
+}
+
+// literal returns the price of a literal: the code of the byte.
+func (hp *huffmanPrices) literal(b byte) int {
+	return hp.literalBits[b]
+}
+
+// match returns the price of a pointer: the codes and extra bits of its length and distance.
+func (hp *huffmanPrices) match(dist, length int) int {
+	sym, _, extraBits := distanceCode.encode(dist)
+	return hp.lengthBits[length] + hp.distanceBits[repCodes+sym] + int(extraBits)
+}
+
+// rep returns the price of a pointer at the i-th recent distance: the code and extra bits of its
+// length and the repeat-offset symbol, which has no extra bits.
+func (hp *huffmanPrices) rep(i, length int) int {
+	return hp.lengthBits[length] + hp.distanceBits[i]
+}
@@ -0,0 +1,109 @@
+// parser_test.go
+// Package lzhuff contains tests for the greedy, lazy and optimal parsers of the LZ77 stage.
+// These tests verify that every parser restores its input, compare the encoded sizes and check
+// that the optimal parser takes the repeat-offset symbols into account.
+
+package lzhuff
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// encodedBits returns the number of bits the Huffman stage spends on values, pricing the pointers
+// at a recent distance at their repeat-offset symbol as the coders do.
+func encodedBits(values []Value) int {
+	prices := newHuffmanPrices(values)
+	reps := newRepDistances()
+	bits := 0
+	for _, v := range values {
+		switch k := reps.index(int(v.distance)); {
+		case v.IsLiteral:
+			bits += prices.literal(v.val)
+			continue
+		case k >= 0:
+			bits += prices.rep(k, int(v.length))
+		default:
+			bits += prices.match(int(v.distance), int(v.length))
+		}
+		reps.update(int(v.distance))
+	}
+	return bits
+}
+
+// Test_parseStrategies tests that every parser restores its input, and that the optimal parser
+// does not produce a larger encoding than the greedy and lazy parsers.
+func Test_parseStrategies(t *testing.T) {
+	strategies := []struct {
+		name     string
+		strategy parseStrategy
+	}{
+		{name: "Greedy", strategy: parseGreedy},
+		{name: "Lazy", strategy: parseLazy},
+		{name: "Lazy2", strategy: parseLazy2},
+		{name: "Optimal", strategy: parseOptimal},
+	}
+
+	for name, input := range testCorpus() {
+		input := input // Capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			bits := make(map[parseStrategy]int)
+			for _, s := range strategies {
+				p := lzParams{minMatch: 4, maxMatch: 255, searchSize: 4096, chainDepth: 64, strategy: s.strategy}
+				values := parseValues(input, 0, p)
+				decoded, err := ValuesToBytes(values)
+				if err != nil {
+					t.Fatalf("%s: ValuesToBytes() error = %v", s.name, err)
+				}
+				if !bytes.Equal(decoded, input) {
+					t.Fatalf("%s: ValuesToBytes(parseValues()) does not restore the input", s.name)
+				}
+				bits[s.strategy] = encodedBits(values)
+			}
+
+			for _, s := range strategies[:3] {
+				if bits[parseOptimal] > bits[s.strategy] {
+					t.Errorf("optimal parse costs %d bits; %s parse costs %d bits", bits[parseOptimal], s.name, bits[s.strategy])
+				}
+			}
+		})
+	}
+}
+
+// Test_optimalParseRepeats tests that the optimal parser of the highest level codes the pointers
+// of records that repeat with two changed bytes at the distance of the previous record, which the
+// repeat-offset symbols make the cheapest.
+func Test_optimalParseRepeats(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	record := make([]byte, 32)
+	rng.Read(record)
+	var input []byte
+	for i := 0; i < 500; i++ {
+		rng.Read(record[7:9])
+		input = append(input, record...)
+	}
+
+	cfg, err := newConfig(defaultConfig(), []Option{WithLevel(MaxLevel)})
+	if err != nil {
+		t.Fatalf("newConfig() error = %v", err)
+	}
+	values := parseValues(input, 0, cfg.lzParams())
+	if decoded, err := ValuesToBytes(values); err != nil || !bytes.Equal(decoded, input) {
+		t.Fatalf("ValuesToBytes(parseValues()) does not restore the input, error = %v", err)
+	}
+	pointers, repeats := 0, 0
+	for i, sym := range encodeDistances(values) {
+		if !values[i].IsLiteral {
+			pointers++
+			if sym.sym < repCodes {
+				repeats++
+			}
+		}
+	}
+	if repeats*10 < pointers*9 {
+		t.Errorf("%d of %d pointers use a repeat-offset symbol; want at least 90%%", repeats, pointers)
+	}
+}
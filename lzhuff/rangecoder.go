@@ -0,0 +1,264 @@
+// rangecoder.go
+// Package lzhuff provides the adaptive binary range coder, the alternative to Huffman coding
+// selected with CoderRange. Every binary decision is coded with a probability that adapts to the
+// decisions seen so far, so a decision taken 99% of the time costs a small fraction of a bit
+// instead of the whole bit a Huffman code spends at least. Multi-symbol alphabets are coded as a
+// sequence of binary decisions along a bit tree. The coder follows the carry-less design of LZMA.
+// Unlike LZMA, a probability adapts at a rate of about 1/n after n decisions, so it tracks their
+// frequency, until the rate settles at the limit of its model and shifting statistics are still
+// followed.
+
+package lzhuff
+
+import (
+	"fmt"
+	"io"
+)
+
+// Parameters of the adaptive probabilities.
+const (
+	probBits = 31              // Precision of a probability.
+	probOne  = 1 << probBits   // Probability one, which no probability reaches.
+	probMin  = 1 << 15         // Smallest probability of either bit, so a decision costs at most 16 bits.
+	rangeTop = uint32(1 << 24) // The range is renormalized when it drops below this value.
+)
+
+// Slowest adaptation rates of the models, as the number of decisions a probability averages over.
+const (
+	probFastRate = 64   // Rate of the decisions whose statistics shift with the data: kinds of values, lengths and distances.
+	probSlowRate = 1024 // Rate of the bits of literals, whose statistics are the most stable.
+)
+
+// probRates holds the adaptation rate of a probability after n decisions, 1/(n+1.5) scaled to
+// 1<<16; the half keeps the first decisions from pinning a probability to a bound.
+var probRates = func() [probSlowRate - 1]uint32 {
+	var rates [probSlowRate - 1]uint32
+	for n := range rates {
+		rates[n] = 2 << 16 / uint32(2*n+3)
+	}
+	return rates
+}()
+
+// prob is the adaptive probability that the next bit of a context is 0.
+type prob struct {
+	p     uint32 // Probability, scaled to probOne.
+	n     uint16 // Number of decisions adapted to, up to limit.
+	limit uint16 // Number of decisions after which the rate stops slowing down.
+}
+
+// newProb returns a probability of one half whose adaptation rate slows down to 1/rate.
+func newProb(rate int) prob {
+	return prob{p: probOne / 2, limit: uint16(rate - 2)}
+}
+
+// update adapts p to bit.
+func (p *prob) update(bit uint32) {
+	rate := uint64(probRates[p.n])
+	if p.n < p.limit {
+		p.n++
+	}
+	if bit == 0 {
+		p.p += uint32(uint64(probOne-p.p) * rate >> 16)
+		if p.p > probOne-probMin {
+			p.p = probOne - probMin
+		}
+	} else {
+		p.p -= uint32(uint64(p.p) * rate >> 16)
+		if p.p < probMin {
+			p.p = probMin
+		}
+	}
+}
+
+// rangeEncoder encodes binary decisions into bytes.
+type rangeEncoder struct {
+	low       uint64 // Lower end of the current interval; bit 32 holds a pending carry.
+	rng       uint32 // Width of the current interval.
+	cache     byte   // Last byte not written yet, as a later carry may still increment it.
+	cacheSize int    // Number of pending bytes: cache followed by cacheSize-1 bytes of 0xff.
+	out       []byte // Encoded bytes.
+}
+
+// newRangeEncoder returns an encoder with an empty output.
+func newRangeEncoder() *rangeEncoder {
+	return &rangeEncoder{rng: 0xffffffff, cacheSize: 1}
+}
+
+// shiftLow moves the top byte of low to the output, resolving pending carries.
+func (e *rangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xff000000 || e.low>>32 != 0 {
+		carry := byte(e.low >> 32)
+		temp := e.cache
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			e.out = append(e.out, temp+carry)
+			temp = 0xff
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0x00ffffff) << 8
+}
+
+// normalize renormalizes the interval after a decision.
+func (e *rangeEncoder) normalize() {
+	for e.rng < rangeTop {
+		e.rng <<= 8
+		e.shiftLow()
+	}
+}
+
+// encodeBit encodes bit with the adaptive probability p and adapts p to it.
+func (e *rangeEncoder) encodeBit(p *prob, bit uint32) {
+	bound := uint32(uint64(e.rng) * uint64(p.p) >> probBits)
+	if bit == 0 {
+		e.rng = bound
+	} else {
+		e.low += uint64(bound)
+		e.rng -= bound
+	}
+	p.update(bit)
+	e.normalize()
+}
+
+// encodeDirect encodes the n low bits of v, most significant first, with a fixed probability of
+// one half. It is used for extra bits, which are close to uniformly distributed.
+func (e *rangeEncoder) encodeDirect(v uint64, n byte) {
+	for ; n > 0; n-- {
+		e.rng >>= 1
+		if v>>(n-1)&1 == 1 {
+			e.low += uint64(e.rng)
+		}
+		e.normalize()
+	}
+}
+
+// finish flushes the pending bytes and returns the encoded bytes. The decoder reads exactly
+// these bytes, so data following them stays byte-aligned.
+func (e *rangeEncoder) finish() []byte {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.out
+}
+
+// rangeDecoder decodes binary decisions encoded by rangeEncoder.
+type rangeDecoder struct {
+	r    io.ByteReader // Source of the encoded bytes.
+	code uint32        // Position of the encoded value within the current interval.
+	rng  uint32        // Width of the current interval.
+	err  error         // First error of r; decoding goes on with zero bytes so callers check it once.
+}
+
+// newRangeDecoder starts decoding the bytes of a rangeEncoder from r.
+// Returns:
+// - The decoder.
+// - An error wrapping ErrCorruptStream if the first byte cannot have been written by the encoder,
+// or ErrTruncatedStream if r ends early.
+func newRangeDecoder(r io.ByteReader) (*rangeDecoder, error) {
+	d := &rangeDecoder{r: r, rng: 0xffffffff}
+	first := d.readByte()
+	for i := 0; i < 4; i++ {
+		d.code = d.code<<8 | uint32(d.readByte())
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("newRangeDecoder: %w", truncated(d.err))
+	}
+	if first != 0 {
+		return nil, fmt.Errorf("newRangeDecoder: first byte %#x: %w", first, ErrCorruptStream)
+	}
+	return d, nil
+}
+
+// readByte returns the next byte of the source, or 0 once it has failed.
+func (d *rangeDecoder) readByte() byte {
+	if d.err != nil {
+		return 0
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		d.err = err
+	}
+	return c
+}
+
+// normalize renormalizes the interval after a decision.
+func (d *rangeDecoder) normalize() {
+	for d.rng < rangeTop {
+		d.rng <<= 8
+		d.code = d.code<<8 | uint32(d.readByte())
+	}
+}
+
+// decodeBit decodes a bit with the adaptive probability p and adapts p to it.
+func (d *rangeDecoder) decodeBit(p *prob) uint32 {
+	bound := uint32(uint64(d.rng) * uint64(p.p) >> probBits)
+	var bit uint32
+	if d.code < bound {
+		d.rng = bound
+	} else {
+		d.code -= bound
+		d.rng -= bound
+		bit = 1
+	}
+	p.update(bit)
+	d.normalize()
+	return bit
+}
+
+// decodeDirect decodes n bits encoded by encodeDirect.
+func (d *rangeDecoder) decodeDirect(n byte) uint64 {
+	var v uint64
+	for ; n > 0; n-- {
+		d.rng >>= 1
+		bit := uint64(0)
+		if d.code >= d.rng {
+			d.code -= d.rng
+			bit = 1
+		}
+		v = v<<1 | bit
+		d.normalize()
+	}
+	return v
+}
+
+// bitTree codes the symbols of an alphabet of 1<<bits symbols as bits binary decisions, most
+// significant first. Each decision has its own adaptive probability, conditioned on the bits
+// before it, which makes the tree an adaptive model of the whole alphabet.
+type bitTree struct {
+	probs []prob // Probability of every inner node; node 1 is the root.
+	bits  int    // Number of bits of a symbol.
+}
+
+// newBitTree returns a bitTree for symbols of the given number of bits with even probabilities
+// whose adaptation rate slows down to 1/rate.
+func newBitTree(bits, rate int) bitTree {
+	return bitTree{probs: newProbs(1<<bits, rate), bits: bits}
+}
+
+// newProbs returns n probabilities of one half whose adaptation rate slows down to 1/rate.
+func newProbs(n, rate int) []prob {
+	probs := make([]prob, n)
+	for i := range probs {
+		probs[i] = newProb(rate)
+	}
+	return probs
+}
+
+// encode encodes sym.
+func (t bitTree) encode(e *rangeEncoder, sym int) {
+	m := 1
+	for i := t.bits - 1; i >= 0; i-- {
+		bit := uint32(sym>>i) & 1
+		e.encodeBit(&t.probs[m], bit)
+		m = m<<1 | int(bit)
+	}
+}
+
+// decode decodes a symbol.
+func (t bitTree) decode(d *rangeDecoder) int {
+	m := 1
+	for i := 0; i < t.bits; i++ {
+		m = m<<1 | int(d.decodeBit(&t.probs[m]))
+	}
+	return m - 1<<t.bits
+}
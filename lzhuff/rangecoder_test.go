@@ -0,0 +1,98 @@
+// rangecoder_test.go
+// Package lzhuff contains tests for the adaptive binary range coder.
+// These tests verify that decisions, bit-tree symbols and direct bits survive a round trip, that
+// the decoder reads exactly the bytes of the encoder, and that skewed decisions cost far less
+// than a bit each.
+
+package lzhuff
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// Test_rangeCoderRoundTrip tests that a mix of adaptive bits, bit-tree symbols and direct bits is
+// restored, and that data following the encoded bytes is left unread.
+func Test_rangeCoderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		skew int // Percentage of zero bits and of symbol 0.
+	}{
+		{name: "Even", skew: 50},
+		{name: "Skewed", skew: 95},
+		{name: "Constant", skew: 100},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			rng := rand.New(rand.NewSource(18))
+			bitsIn := make([]uint32, 5000)
+			symsIn := make([]int, len(bitsIn))
+			directIn := make([]uint64, len(bitsIn))
+			for i := range bitsIn {
+				if rng.Intn(100) >= tt.skew {
+					bitsIn[i] = 1
+					symsIn[i] = rng.Intn(64)
+				}
+				directIn[i] = uint64(rng.Int63n(1 << 20))
+			}
+
+			p, tree := newProb(probFastRate), newBitTree(6, probSlowRate)
+			e := newRangeEncoder()
+			for i := range bitsIn {
+				e.encodeBit(&p, bitsIn[i])
+				tree.encode(e, symsIn[i])
+				e.encodeDirect(directIn[i], 20)
+			}
+			stream := append(e.finish(), "tail"...)
+
+			r := bytes.NewReader(stream)
+			d, err := newRangeDecoder(r)
+			if err != nil {
+				t.Fatalf("newRangeDecoder() error = %v", err)
+			}
+			p, tree = newProb(probFastRate), newBitTree(6, probSlowRate)
+			for i := range bitsIn {
+				if bit := d.decodeBit(&p); bit != bitsIn[i] {
+					t.Fatalf("decision %d = %d; want %d", i, bit, bitsIn[i])
+				}
+				if sym := tree.decode(d); sym != symsIn[i] {
+					t.Fatalf("symbol %d = %d; want %d", i, sym, symsIn[i])
+				}
+				if v := d.decodeDirect(20); v != directIn[i] {
+					t.Fatalf("direct bits %d = %d; want %d", i, v, directIn[i])
+				}
+			}
+			if d.err != nil {
+				t.Fatalf("decoder error = %v", d.err)
+			}
+			if r.Len() != len("tail") {
+				t.Errorf("decoder left %d bytes unread; want %d", r.Len(), len("tail"))
+			}
+		})
+	}
+}
+
+// Test_rangeCoderSkewedBits tests that decisions taken 98% of the time cost a small fraction of
+// the bit every prefix code spends on them.
+func Test_rangeCoderSkewedBits(t *testing.T) {
+	rng := rand.New(rand.NewSource(18))
+	const n = 100000
+	p := newProb(probFastRate)
+	e := newRangeEncoder()
+	for i := 0; i < n; i++ {
+		bit := uint32(0)
+		if rng.Intn(100) < 2 {
+			bit = 1
+		}
+		e.encodeBit(&p, bit)
+	}
+	// The entropy of the decisions is 0.14 bits each.
+	if got, limit := len(e.finish())*8, n/5; got > limit {
+		t.Errorf("%d decisions took %d bits; want at most %d", n, got, limit)
+	}
+}
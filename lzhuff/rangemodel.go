@@ -0,0 +1,222 @@
+// rangemodel.go
+// Package lzhuff provides the adaptive model that codes Values with the range coder. A Value is
+// coded as a literal/pointer decision, conditioned on the kind of the previous Value, followed by
+// the literal byte or the length and distance symbols of the pointer, each coded along a bit tree.
+// With literal contexts, every class of the previous byte has its own literal tree. The literal
+// right after a pointer is coded against the byte that would have extended the match, as in LZMA:
+// while its bits agree with that byte they are predicted by their own tree. Extra bits are coded
+// directly. The model is never stored in the stream: the encoder and the decoder start from
+// the same even probabilities and adapt them in lockstep across all blocks.
+
+package lzhuff
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// rangeLengthEOB is the symbol of the length tree that marks the end of a block. The symbols of
+// lengthCode follow it.
+const rangeLengthEOB = 0
+
+// rangeModel holds the adaptive probabilities of the range coder for one stream.
+type rangeModel struct {
+	isMatch   [2]prob   // Probability of a literal, after a literal and after a pointer.
+	afterPtr  int       // Context of the next decision: 1 after a pointer, 0 otherwise.
+	literals  []bitTree // Model of the literal bytes, indexed by literal context.
+	matched   []prob    // Model of the literal after a pointer: 0x100 probabilities for every bit of the match byte, then the plain tree.
+	lengths   bitTree   // Model of rangeLengthEOB and the lengthCode symbols.
+	distances bitTree   // Model of the repeat-offset and distanceCode symbols.
+}
+
+// newRangeModel returns the model every stream starts with.
+func newRangeModel() *rangeModel {
+	m := &rangeModel{
+		isMatch:   [2]prob{newProb(probFastRate), newProb(probFastRate)},
+		literals:  make([]bitTree, literalContexts),
+		matched:   newProbs(0x300, probSlowRate),
+		lengths:   newBitTree(bits.Len(uint(lengthCode.symbols)), probFastRate),
+		distances: newBitTree(bits.Len(uint(distanceSymbols-1)), probFastRate),
+	}
+	for ctx := range m.literals {
+		m.literals[ctx] = newBitTree(8, probSlowRate)
+	}
+	return m
+}
+
+// encodeBlock encodes values followed by the end-of-block marker.
+// Parameters:
+// - buf: The history followed by the bytes of the block.
+// - start: The index in buf of the block's first byte.
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+// Returns:
+// - The encoded bytes, which the decoder reads exactly.
+func (m *rangeModel) encodeBlock(buf []byte, start int, values []Value, contexts []byte) []byte {
+	e := newRangeEncoder()
+	reps := newRepDistances()
+	pos, matchByte := start, -1
+	for i, v := range values {
+		m.encodeValue(e, v, contextOf(contexts, i), matchByte, &reps)
+		if v.IsLiteral {
+			pos, matchByte = pos+1, -1
+		} else if pos += int(v.length); pos < len(buf) {
+			matchByte = int(buf[pos-int(v.distance)])
+		}
+	}
+	m.encodeValue(e, endOfBlock, contextOf(contexts, len(values)), matchByte, &reps)
+	return e.finish()
+}
+
+// encodeValue encodes a single Value in literal context ctx and adapts the model to it.
+// A literal right after a pointer is coded against matchByte, which is -1 after a literal.
+// The recent distances reps are updated with the distance of a pointer.
+func (m *rangeModel) encodeValue(e *rangeEncoder, v Value, ctx, matchByte int, reps *repDistances) {
+	if v.IsLiteral {
+		e.encodeBit(&m.isMatch[m.afterPtr], 0)
+		m.afterPtr = 0
+		if matchByte >= 0 {
+			m.encodeMatched(e, int(v.val), matchByte)
+		} else {
+			m.literals[ctx].encode(e, int(v.val))
+		}
+		return
+	}
+	e.encodeBit(&m.isMatch[m.afterPtr], 1)
+	m.afterPtr = 1
+	if v.isEndOfBlock() {
+		m.lengths.encode(e, rangeLengthEOB)
+		return
+	}
+
+	sym, extra, extraBits := lengthCode.encode(int(v.length))
+	m.lengths.encode(e, rangeLengthEOB+1+sym)
+	e.encodeDirect(extra, extraBits)
+	sym, extra, extraBits = reps.encode(int(v.distance))
+	m.distances.encode(e, sym)
+	e.encodeDirect(extra, extraBits)
+}
+
+// decodeBlock decodes the values of a block from r and appends the bytes they stand for to
+// window, like BinaryReader.decodeBlock.
+// Parameters:
+// - r: The source of the encoded bytes, positioned at the start of the block's bytes.
+// - window: The search window preceding the block.
+// - limit: The number of bytes the block may decode to.
+// - contexts: The number of literal contexts, 1 without literal contexts.
+// Returns:
+// - window extended with the bytes of the block.
+// - An error wrapping ErrCorruptStream if a symbol or value is out of range, ErrInvalidDistance
+// if a pointer reaches before the window, ErrSizeMismatch if the block exceeds limit, or
+// ErrTruncatedStream if r ends early.
+func (m *rangeModel) decodeBlock(r io.ByteReader, window []byte, limit, contexts int) ([]byte, error) {
+	d, err := newRangeDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(window) + limit
+	reps := newRepDistances()
+	matchByte := -1
+	for d.err == nil {
+		if d.decodeBit(&m.isMatch[m.afterPtr]) == 0 {
+			m.afterPtr = 0
+			if len(window) == end {
+				return nil, fmt.Errorf("rangeModel.decodeBlock: block exceeds %d bytes: %w", limit, ErrSizeMismatch)
+			}
+			if matchByte >= 0 {
+				window = append(window, byte(m.decodeMatched(d, matchByte)))
+				matchByte = -1
+				continue
+			}
+			ctx := 0
+			if contexts > 1 {
+				ctx = windowContext(window)
+			}
+			window = append(window, byte(m.literals[ctx].decode(d)))
+			continue
+		}
+		m.afterPtr = 1
+
+		sym := m.lengths.decode(d)
+		if sym == rangeLengthEOB {
+			break
+		}
+		length, err := decodeExtra(d, lengthCode, sym-rangeLengthEOB-1)
+		if err != nil {
+			return nil, err
+		}
+		distance := 0
+		if sym := m.distances.decode(d); sym < repCodes {
+			distance = reps.use(sym)
+		} else {
+			if distance, err = decodeExtra(d, distanceCode, sym-repCodes); err != nil {
+				return nil, err
+			}
+			reps.push(distance)
+		}
+		if distance > len(window) {
+			return nil, fmt.Errorf("rangeModel.decodeBlock: distance %d with %d bytes of output: %w", distance, len(window), ErrInvalidDistance)
+		}
+		if length > end-len(window) {
+			return nil, fmt.Errorf("rangeModel.decodeBlock: block exceeds %d bytes: %w", limit, ErrSizeMismatch)
+		}
+		window = appendMatch(window, distance, length)
+		matchByte = int(window[len(window)-distance])
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("rangeModel.decodeBlock: %w", truncated(d.err))
+	}
+	return window, nil
+}
+
+// encodeMatched encodes the literal sym that follows a pointer, against the byte matchByte that
+// would have extended the pointer's match.
+func (m *rangeModel) encodeMatched(e *rangeEncoder, sym, matchByte int) {
+	n, agree := 1, true
+	for i := 7; i >= 0; i-- {
+		bit := uint32(sym>>i) & 1
+		if agree {
+			mb := matchByte >> i & 1
+			e.encodeBit(&m.matched[(1+mb)<<8+n], bit)
+			agree = int(bit) == mb
+		} else {
+			e.encodeBit(&m.matched[n], bit)
+		}
+		n = n<<1 | int(bit)
+	}
+}
+
+// decodeMatched decodes a literal encoded by encodeMatched.
+func (m *rangeModel) decodeMatched(d *rangeDecoder, matchByte int) int {
+	n, agree := 1, true
+	for i := 7; i >= 0; i-- {
+		var bit uint32
+		if agree {
+			mb := matchByte >> i & 1
+			bit = d.decodeBit(&m.matched[(1+mb)<<8+n])
+			agree = int(bit) == mb
+		} else {
+			bit = d.decodeBit(&m.matched[n])
+		}
+		n = n<<1 | int(bit)
+	}
+	return n - 0x100
+}
+
+// decodeExtra decodes the extra bits of a bucket symbol and returns the value they select.
+// Returns:
+// - The selected value.
+// - An error wrapping ErrCorruptStream if sym or the value is beyond the range of c.
+func decodeExtra(d *rangeDecoder, c extraCode, sym int) (int, error) {
+	if sym >= c.symbols {
+		return 0, fmt.Errorf("decodeExtra: symbol %d of %d: %w", sym, c.symbols, ErrCorruptStream)
+	}
+	base, extraBits := c.bucket(sym)
+	v := base + int(d.decodeDirect(extraBits))
+	if v > c.last {
+		return 0, fmt.Errorf("decodeExtra: value %d exceeds %d: %w", v, c.last, ErrCorruptStream)
+	}
+	return v, nil
+}
@@ -0,0 +1,167 @@
+// reader.go
+// Package lzhuff provides the Reader type, the public entry point for decompression.
+// A Reader decodes a stream produced by Writer one block at a time and serves the original bytes
+// through the io.Reader interface. Only the current block and the search window preceding it are
+// kept in memory.
+
+package lzhuff
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Reader is an io.Reader that decompresses data read from an underlying io.Reader.
+// The container header is read by NewReader; blocks are decoded as Read needs them.
+type Reader struct {
+	br     BinaryReader // Bit-level reader over the compressed stream.
+	model  *rangeModel  // Adaptive model of the range coder, or nil for the other coders.
+	header Header       // Container header read by NewReader.
+	window []byte       // Search window followed by the bytes of the current block.
+	out    []byte       // Decompressed bytes of the current block not yet returned to the caller.
+	size   uint64       // Number of uncompressed bytes decoded so far.
+	crc    uint32       // CRC-32 of the uncompressed bytes decoded so far.
+	done   bool         // Whether the final block has been decoded and the trailer verified.
+	err    error        // Error encountered while decoding, returned by every later Read.
+}
+
+// NewReader returns a new Reader decompressing data from r.
+// It reads and validates the container header before returning.
+// Parameters:
+// - r: The io.Reader providing the compressed stream.
+// Returns:
+// - The Reader.
+// - An error wrapping ErrInvalidHeader, ErrUnsupportedVersion or ErrTruncatedStream if the
+// header cannot be used.
+func NewReader(r io.Reader) (*Reader, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	z := &Reader{br: NewBinaryReader(r), header: header}
+	if header.Coder == CoderRange {
+		z.model = newRangeModel()
+	}
+	return z, nil
+}
+
+// Header returns the container header of the stream, including the uncompressed length if the
+// encoder knew it up front.
+func (z *Reader) Header() Header {
+	return z.header
+}
+
+// Read reads decompressed data into p. It implements io.Reader.
+// Errors encountered while decoding wrap one of the package's sentinel errors. The data of a
+// block is returned once the block has been decoded; the checksum of the whole stream is verified
+// after the final block, so Read only returns io.EOF for an intact stream.
+func (z *Reader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		if z.done {
+			return 0, io.EOF
+		}
+		z.nextBlock()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+// WriteTo writes the decompressed data to w straight from the output window, without copying it
+// into an intermediate buffer. It implements io.WriterTo, which io.Copy uses.
+// Returns:
+// - The number of bytes written.
+// - The first error encountered while decoding or writing; io.EOF is not an error.
+func (z *Reader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		if len(z.out) > 0 {
+			n, err := w.Write(z.out)
+			written += int64(n)
+			z.out = z.out[n:]
+			if err != nil {
+				return written, err
+			}
+		}
+		if z.err != nil {
+			return written, z.err
+		}
+		if z.done {
+			return written, nil
+		}
+		z.nextBlock()
+	}
+}
+
+// nextBlock decodes the next block, recording the error if it fails.
+func (z *Reader) nextBlock() {
+	if z.err = z.readBlock(); z.err != nil {
+		// Data failing verification is never returned.
+		z.out = nil
+	}
+}
+
+// readBlock decodes the next block directly into the output window and points z.out at its
+// bytes. After the final block it verifies the trailer.
+func (z *Reader) readBlock() error {
+	buf := make([]byte, blockHeaderSize)
+	if err := z.br.readAligned(buf); err != nil {
+		return err
+	}
+	bh, err := parseBlockHeader(buf)
+	if err != nil {
+		return err
+	}
+	if z.header.Coder != CoderHuffman && bh.reuseTable {
+		return fmt.Errorf("Reader.readBlock: %v coded block reuses a table: %w", z.header.Coder, ErrCorruptStream)
+	}
+	if z.header.Coder == CoderHuffman && !bh.reuseTable {
+		if err := z.br.readTables(bh.contexts()); err != nil {
+			return err
+		}
+	}
+	if bh.reuseTable && z.br.hasTables && len(z.br.litLen) != bh.contexts() {
+		return fmt.Errorf("Reader.readBlock: block with %d literal contexts reuses tables of %d: %w", bh.contexts(), len(z.br.litLen), ErrCorruptStream)
+	}
+
+	// Drop the history no pointer can reach anymore before decoding the block after it.
+	if keep := int(z.header.SearchSize); len(z.window) > keep {
+		z.window = z.window[:copy(z.window, z.window[len(z.window)-keep:])]
+	}
+	start := len(z.window)
+	switch z.header.Coder {
+	case CoderRange:
+		z.window, err = z.model.decodeBlock(z.br.r, z.window, int(bh.size), bh.contexts())
+	case CoderFSE:
+		z.window, err = z.br.decodeFSEBlock(z.window, int(bh.size), bh.contexts())
+	default:
+		z.window, err = z.br.decodeBlock(z.window, int(bh.size))
+	}
+	if err != nil {
+		return err
+	}
+	if n := len(z.window) - start; n != int(bh.size) {
+		return fmt.Errorf("Reader.readBlock: decoded %d bytes, block header says %d: %w", n, bh.size, ErrSizeMismatch)
+	}
+	z.out = z.window[start:]
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, z.out)
+	z.size += uint64(bh.size)
+
+	if !bh.last {
+		return nil
+	}
+	z.done = true
+	if z.header.Flags&FlagContentSize != 0 && z.size != z.header.Size {
+		return fmt.Errorf("Reader.readBlock: decoded %d bytes, header says %d: %w", z.size, z.header.Size, ErrSizeMismatch)
+	}
+	// Verify the checksum of the decompressed data stored in the trailer.
+	trailer := make([]byte, trailerSize)
+	if err := z.br.readAligned(trailer); err != nil {
+		return err
+	}
+	return verifyTrailer(trailer, z.crc, z.size)
+}
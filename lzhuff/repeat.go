@@ -0,0 +1,114 @@
+// repeat.go
+// Package lzhuff provides the repeat-offset codes of the distance alphabet. Structured data such as
+// tables and binary records reuses the same few distances over and over, so the coders keep the
+// most recent distances of a block, most recent first, and code a pointer whose distance is one of
+// them with a dedicated symbol and no extra bits, as LZMA and zstd do. The recent distances start
+// over in every block, so the parser, every encoder and every decoder track the same list.
+
+package lzhuff
+
+// repCodes is the number of recent distances with a symbol of their own. They are the first
+// symbols of the distance alphabet, followed by the symbols of distanceCode.
+const repCodes = 3
+
+// distanceSymbols is the size of the distance alphabet.
+var distanceSymbols = repCodes + distanceCode.symbols
+
+// repDistances holds the most recent distances of a block, most recent first.
+type repDistances [repCodes]int
+
+// newRepDistances returns the recent distances every block starts with.
+func newRepDistances() repDistances {
+	return repDistances{1, 4, 8}
+}
+
+// index returns the position of distance among the recent distances, or -1.
+func (r *repDistances) index(distance int) int {
+	for i, d := range r {
+		if d == distance {
+			return i
+		}
+	}
+	return -1
+}
+
+// use moves the i-th recent distance to the front and returns it.
+func (r *repDistances) use(i int) int {
+	distance := r[i]
+	copy(r[1:i+1], r[:i])
+	r[0] = distance
+	return distance
+}
+
+// push makes distance the most recent one, dropping the oldest.
+func (r *repDistances) push(distance int) {
+	copy(r[1:], r[:repCodes-1])
+	r[0] = distance
+}
+
+// update records distance as the most recent one.
+func (r *repDistances) update(distance int) {
+	if i := r.index(distance); i >= 0 {
+		r.use(i)
+		return
+	}
+	r.push(distance)
+}
+
+// encode returns the symbol of the distance alphabet and the extra bits of a pointer at distance,
+// and records the distance as the most recent one.
+func (r *repDistances) encode(distance int) (int, uint64, byte) {
+	i := r.index(distance)
+	r.update(distance)
+	if i >= 0 {
+		return i, 0, 0
+	}
+	sym, extra, extraBits := distanceCode.encode(distance)
+	return repCodes + sym, extra, extraBits
+}
+
+// encodeDistances returns the distance symbol and extra bits of every pointer of values, indexed
+// like values, for coders that need them out of order.
+func encodeDistances(values []Value) []distanceSymbol {
+	reps := newRepDistances()
+	syms := make([]distanceSymbol, len(values))
+	for i, v := range values {
+		if !v.IsLiteral {
+			syms[i].sym, syms[i].extra, syms[i].extraBits = reps.encode(int(v.distance))
+		}
+	}
+	return syms
+}
+
+// distanceSymbol is the coded form of the distance of a pointer.
+type distanceSymbol struct {
+	sym       int    // Symbol of the distance alphabet.
+	extra     uint64 // Extra bits following the symbol.
+	extraBits byte   // Number of extra bits.
+}
+
+// repMatch returns the longest match at pos whose distance is one of the recent distances.
+// Parameters:
+// - input: The history followed by the bytes being parsed.
+// - pos: The position of the match.
+// - maxLen: The length of the longest match allowed.
+// - window: The largest distance allowed.
+// Returns:
+// - The distance of the match and its length, 0 if no recent distance matches a byte.
+func (r *repDistances) repMatch(input []byte, pos, maxLen, window int) (int, int) {
+	maxLen = min(maxLen, len(input)-pos)
+	bestDist, bestLen := 0, 0
+	for _, d := range r {
+		if d > pos || d > window {
+			continue
+		}
+		n := 0
+		for n < maxLen && input[pos+n] == input[pos+n-d] {
+			n++
+		}
+		if n > bestLen {
+			bestDist, bestLen = d, n
+		}
+	}
+	return bestDist, bestLen
+}
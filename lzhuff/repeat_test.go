@@ -0,0 +1,95 @@
+// repeat_test.go
+// Package lzhuff contains tests for the repeat-offset codes.
+// These tests verify that recent distances get their own symbols and move to the front when used,
+// that new distances push out the oldest one, and that decoding the symbols restores the distances.
+
+package lzhuff
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test_repDistances tests the symbols of a sequence of distances and the recent distances after it.
+func Test_repDistances(t *testing.T) {
+	newSym := func(distance int) int {
+		sym, _, _ := distanceCode.encode(distance)
+		return repCodes + sym
+	}
+
+	tests := []struct {
+		name      string
+		distances []int
+		wantSyms  []int
+		wantReps  repDistances
+	}{
+		{name: "Initial distances", distances: []int{1, 8, 8}, wantSyms: []int{0, 2, 0}, wantReps: repDistances{8, 1, 4}},
+		{name: "New distance", distances: []int{100}, wantSyms: []int{newSym(100)}, wantReps: repDistances{100, 1, 4}},
+		{name: "Oldest dropped", distances: []int{16, 32, 8}, wantSyms: []int{newSym(16), newSym(32), newSym(8)}, wantReps: repDistances{8, 32, 16}},
+		{name: "Alternating", distances: []int{24, 12, 24, 12}, wantSyms: []int{newSym(24), newSym(12), 1, 1}, wantReps: repDistances{12, 24, 1}},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			enc, dec := newRepDistances(), newRepDistances()
+			var syms []int
+			for _, distance := range tt.distances {
+				sym, extra, extraBits := enc.encode(distance)
+				syms = append(syms, sym)
+
+				// Resolve the symbol like the decoders do.
+				got := 0
+				if sym < repCodes {
+					got = dec.use(sym)
+				} else {
+					base, _ := distanceCode.bucket(sym - repCodes)
+					got = base + int(extra)
+					dec.push(got)
+				}
+				if got != distance {
+					t.Errorf("distance %d decodes as %d (%d extra bits)", distance, got, extraBits)
+				}
+			}
+			if !reflect.DeepEqual(syms, tt.wantSyms) {
+				t.Errorf("symbols = %v; want %v", syms, tt.wantSyms)
+			}
+			if enc != tt.wantReps || dec != tt.wantReps {
+				t.Errorf("recent distances = %v and %v; want %v", enc, dec, tt.wantReps)
+			}
+		})
+	}
+}
+
+// Test_repMatch tests that the longest match at a recent distance is found within the window.
+func Test_repMatch(t *testing.T) {
+	input := []byte("abcdXbcdYabcdZ")
+
+	tests := []struct {
+		name     string
+		reps     repDistances
+		maxLen   int
+		window   int
+		wantDist int
+		wantLen  int
+	}{
+		{name: "Longest recent match", reps: repDistances{5, 9, 4}, maxLen: 255, window: 255, wantDist: 9, wantLen: 4},
+		{name: "Limited length", reps: repDistances{5, 9, 4}, maxLen: 2, window: 255, wantDist: 9, wantLen: 2},
+		{name: "Outside the window", reps: repDistances{5, 9, 4}, maxLen: 255, window: 8, wantDist: 0, wantLen: 0},
+		{name: "Before the start", reps: repDistances{10, 11, 12}, maxLen: 255, window: 255, wantDist: 0, wantLen: 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			dist, length := tt.reps.repMatch(input, 9, tt.maxLen, tt.window)
+			if dist != tt.wantDist || length != tt.wantLen {
+				t.Errorf("repMatch() = %d, %d; want %d, %d", dist, length, tt.wantDist, tt.wantLen)
+			}
+		})
+	}
+}
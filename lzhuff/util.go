@@ -0,0 +1,23 @@
+// util.go
+// Package lzhuff provides utility functions for basic operations such as calculating
+// the minimum and maximum of two integers.
+
+package lzhuff
+
+// min returns the smaller of two integers.
+// If both integers are equal, it returns the first one.
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// max returns the larger of two integers.
+// If both integers are equal, it returns the first one.
+func max(a, b int) int {
+	if a < b {
+		return b
+	}
+	return a
+}
@@ -1,14 +1,13 @@
 // values.go
-// Package main provides functionality for encoding and decoding data using a simplified LZ77 compression algorithm.
+// Package lzhuff provides functionality for encoding and decoding data using a simplified LZ77 compression algorithm.
 // It defines the Value type, which represents either a literal byte or a pointer to a previous sequence in the data.
 // The package includes functions to convert between byte slices and Value slices, as well as utility functions to support these operations.
 
-package main
+package lzhuff
 
 import (
 	"encoding/binary"
 	"fmt"
-	"log"
 )
 
 // Value represents an element in the LZ77 compression sequence.
@@ -20,17 +19,21 @@ type Value struct {
 	val byte // The literal byte value.
 
 	// Pointer representation.
-	distance uint16 // The distance back from the current position to the start of the matching sequence.
-	length   byte   // The length of the matching sequence.
+	distance uint32 // The distance back from the current position to the start of the matching sequence.
+	length   uint16 // The length of the matching sequence.
 }
 
+// endOfBlock is the Value that terminates every serialized stream of Values.
+// It is a pointer with zero distance and length, which LZ77 compression never produces.
+var endOfBlock = NewValue(false, 0, 0, 0)
+
 // NewValue constructs a new Value instance.
 // Parameters:
 // - isLiteral: true if the Value is a literal byte, false if it is a pointer.
 // - value: the literal byte value (ignored if isLiteral is false).
 // - length: the length of the match (relevant if isLiteral is false).
 // - distance: the distance back to the match (relevant if isLiteral is false).
-func NewValue(isLiteral bool, value, length byte, distance uint16) Value {
+func NewValue(isLiteral bool, value byte, length uint16, distance uint32) Value {
 	return Value{
 		IsLiteral: isLiteral,
 		val:       value,
@@ -49,6 +52,11 @@ func (v Value) String() string {
 	return fmt.Sprintf("<%d,%d>", v.distance, v.length)
 }
 
+// isEndOfBlock reports whether v is the end-of-block marker.
+func (v Value) isEndOfBlock() bool {
+	return !v.IsLiteral && v.distance == 0
+}
+
 // GetLiteralBinary returns the binary representation of a literal Value.
 // It simply returns the literal byte.
 func (v *Value) GetLiteralBinary() byte {
@@ -57,74 +65,36 @@ func (v *Value) GetLiteralBinary() byte {
 
 // GetPointerBinary returns the binary representation of a pointer Value.
 // It serializes the distance and length into a byte slice using big-endian encoding.
-// The first two bytes represent the distance, and the third byte represents the length.
+// The first four bytes represent the distance, and the last two bytes represent the length.
 func (v *Value) GetPointerBinary() []byte {
-	bytes := make([]byte, 3)
-	// Encode the distance as the first two bytes in big-endian order.
-	binary.BigEndian.PutUint16(bytes, v.distance)
-	// The third byte is the length.
-	bytes[2] = v.length
+	bytes := make([]byte, 6)
+	// Encode the distance as the first four bytes in big-endian order.
+	binary.BigEndian.PutUint32(bytes, v.distance)
+	// The last two bytes are the length.
+	binary.BigEndian.PutUint16(bytes[4:], v.length)
 	return bytes
 }
 
 // BytesToValues converts a byte slice into a slice of Value instances using LZ77 compression.
 // It replaces sequences of bytes with pointers to previous occurrences where possible.
+// Every candidate in the search buffer is considered, so the longest match is always found.
+// Its parameters cover the classic limits of 255-byte matches and a 64 KiB window; use Writer
+// options for longer matches and larger windows.
 // Parameters:
 // - input: the input byte slice to be compressed.
 // - minMatchLen: the minimum length of a match to be considered for compression.
 // - maxMatchLen: the maximum length of a match.
 // - maxSearchBuffLen: the maximum length of the search buffer.
 func BytesToValues(input []byte, minMatchLen, maxMatchLen byte, maxSearchBuffLen uint16) []Value {
-	var (
-		searchBuffStart  int
-		lookaheadBuffEnd int
-		matchPos         int
-		matchLen         byte
-		distance         uint16
-	)
-
-	// Preallocate the values slice with the length of input.
-	// It is likely to be over-allocated, but slicing will adjust the final size.
-	values := make([]Value, len(input))
-	valueCounter := 0   // Tracks the number of values added.
-	pointerCounter := 0 // Tracks the number of pointers used.
-
-	for split := 0; split < len(input); split++ {
-		// Define the boundaries of the search buffer.
-		searchBuffStart = max(0, split-int(maxSearchBuffLen))
-		// Define the end of the lookahead buffer.
-		lookaheadBuffEnd = min(len(input), split+int(maxMatchLen))
-
-		// Find the longest match position and length within the current buffers.
-		matchPos, matchLen = getLongestMatchPosAndLen(
-			input[searchBuffStart:split],
-			input[split:lookaheadBuffEnd],
-			minMatchLen,
-		)
-
-		if split > int(minMatchLen) && matchLen > 0 {
-			// Calculate the distance from the current position to the match position.
-			distance = uint16(split - (matchPos + searchBuffStart))
-			// Create a pointer Value.
-			values[valueCounter] = NewValue(false, 0, matchLen, distance)
-			valueCounter++
-			// Advance the split position by the length of the match minus one.
-			split += int(matchLen) - 1
-			pointerCounter++
-		} else {
-			// Create a literal Value.
-			values[valueCounter] = NewValue(true, input[split], 1, 0)
-			valueCounter++
-		}
-	}
-
-	// Log the ratio of pointers to total values for diagnostic purposes.
-	log.Printf("Pointers ratio: %.2f\n", float64(pointerCounter)/float64(valueCounter))
-	// Return the slice of values up to the number of values added.
-	return values[:valueCounter]
+	return parseValues(input, 0, lzParams{
+		minMatch:   int(minMatchLen),
+		maxMatch:   int(maxMatchLen),
+		searchSize: int(maxSearchBuffLen),
+	})
 }
 
 // getLongestMatchPosAndLen finds the position and length of the longest match between the text and the pattern.
+// It scans the whole text and is kept as the reference implementation for the matchFinder.
 // Parameters:
 // - text: the search buffer where matches are sought.
 // - pattern: the lookahead buffer where matches are compared.
@@ -225,21 +195,52 @@ func getMatchLen(a, b []byte) byte {
 // - values: the slice of Value instances to be converted.
 // Returns:
 // - A byte slice representing the reconstructed data.
-func ValuesToBytes(values []Value) []byte {
-	var from int
-	bytesResult := make([]byte, 0, len(values)) // Preallocate with an estimated capacity.
+// - An error wrapping ErrInvalidDistance if a pointer refers to data that does not exist.
+func ValuesToBytes(values []Value) ([]byte, error) {
+	return appendValues(make([]byte, 0, len(values)), values) // Preallocate with an estimated capacity.
+}
 
-	for _, v := range values {
+// appendValues reconstructs the data represented by values and appends it to dst.
+// Pointers may refer to the bytes already in dst, which act as the history of the values.
+// Parameters:
+// - dst: the history the values were compressed against.
+// - values: the slice of Value instances to be converted.
+// Returns:
+// - dst extended with the reconstructed data.
+// - An error wrapping ErrInvalidDistance if a pointer refers to data that does not exist.
+func appendValues(dst []byte, values []Value) ([]byte, error) {
+	bytesResult := dst
+
+	for i, v := range values {
 		if v.IsLiteral {
 			// Append the literal byte directly.
 			bytesResult = append(bytesResult, v.val)
-		} else {
-			// Calculate the starting index from which to copy the bytes.
-			from = len(bytesResult) - int(v.distance)
-			// Append the matched sequence based on distance and length.
-			bytesResult = append(bytesResult, bytesResult[from:from+int(v.length)]...)
+			continue
 		}
+
+		// Reject pointers reaching before the start of the output.
+		if v.distance == 0 || int(v.distance) > len(bytesResult) {
+			return nil, fmt.Errorf("appendValues: value %d: distance %d with %d bytes of output: %w",
+				i, v.distance, len(bytesResult), ErrInvalidDistance)
+		}
+		bytesResult = appendMatch(bytesResult, int(v.distance), int(v.length))
 	}
 
-	return bytesResult
+	return bytesResult, nil
+}
+
+// appendMatch appends length bytes copied from distance bytes back in dst to dst.
+// The distance must not exceed len(dst).
+func appendMatch(dst []byte, distance, length int) []byte {
+	// Calculate the starting index from which to copy the bytes.
+	from := len(dst) - distance
+	if length <= distance {
+		// Append the matched sequence based on distance and length.
+		return append(dst, dst[from:from+length]...)
+	}
+	// The match overlaps the bytes it produces, so copy it one byte at a time.
+	for j := 0; j < length; j++ {
+		dst = append(dst, dst[from+j])
+	}
+	return dst
 }
@@ -1,9 +1,9 @@
 // values_test.go
-// Package main contains tests for utility functions related to value matching and conversion.
+// Package lzhuff contains tests for utility functions related to value matching and conversion.
 // These tests verify the correctness of functions like getLongestMatchPosAndLen, getMatchIndex,
 // BytesToValues, and ValuesToBytes.
 
-package main
+package lzhuff
 
 import (
 	"crypto/rand"
@@ -163,7 +163,7 @@ func Test_getMatchIndex(t *testing.T) {
 			name:        "Several matches",
 			text:        []byte("aaaabcaaaabcaaaabc"),
 			pattern:     []byte("abc"),
-			wantMatches: []int{4, 10, 16},
+			wantMatches: []int{3, 9, 15},
 		},
 	}
 
@@ -230,7 +230,7 @@ func Test_bytesToValues(t *testing.T) {
 			minMatchLen:      2,
 			maxMatchLen:      255,
 			maxSearchBuffLen: 255,
-			wantValuesRepr:   "XXab<4,2>cd<8,2>",
+			wantValuesRepr:   "XXab<4,2>cd<4,2>", // The recent distance wins the tie.
 		},
 		{
 			name:             "Three matches with same length",
@@ -238,7 +238,7 @@ func Test_bytesToValues(t *testing.T) {
 			minMatchLen:      2,
 			maxMatchLen:      255,
 			maxSearchBuffLen: 255,
-			wantValuesRepr:   "XXab<4,2>cd<8,2>ij<12,2>",
+			wantValuesRepr:   "XXab<4,2>cd<4,2>ij<4,2>",
 		},
 		{
 			name:             "A match, almost too long",
@@ -333,7 +333,10 @@ func Test_ValuesToBytes(t *testing.T) {
 			values := BytesToValues(tt.input, 255, 255, 3)
 
 			// Convert values back to bytes
-			got := ValuesToBytes(values)
+			got, err := ValuesToBytes(values)
+			if err != nil {
+				t.Fatalf("ValuesToBytes() error = %v", err)
+			}
 
 			if string(got) != string(tt.input) {
 				t.Errorf("ValuesToBytes() = '%s'; want '%s'", string(got), string(tt.input))
@@ -0,0 +1,273 @@
+// writer.go
+// Package lzhuff provides the Writer type, the public entry point for compression.
+// A Writer splits the data written to it into blocks and compresses every block as soon as it is
+// complete, so memory use is bounded by the block size and the search window regardless of the
+// length of the input. Pointers may refer back into earlier blocks through a sliding window. With
+// Huffman coding, every block either carries code tables fitted to its own statistics or reuses
+// the tables of the previous block, whichever encodes it in fewer bits; with tANS coding, every
+// block carries its own tables; with the range coder, the adaptive model carries over from block
+// to block.
+
+package lzhuff
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Writer is an io.WriteCloser that compresses the data written to it.
+// Data is compressed one block at a time; Close compresses the final block and writes the trailer.
+type Writer struct {
+	w       io.Writer   // Destination of the compressed stream.
+	cfg     config      // Settings applied by the options passed to NewWriter.
+	in      blockInput  // Sliding window: history followed by the input not compressed yet.
+	started bool        // Whether the container header has been written.
+	codes   *CodeTables // Code tables of the previous block, or nil before the first block.
+	model   *rangeModel // Adaptive model of the range coder, or nil for the other coders.
+	size    uint64      // Number of uncompressed bytes compressed so far.
+	crc     uint32      // CRC-32 of the uncompressed bytes compressed so far.
+	closed  bool        // Whether Close has already been called.
+	err     error       // First error encountered, returned by every later call.
+}
+
+// NewWriter returns a new Writer compressing data to w.
+// It returns an error if any of the options is invalid.
+// Parameters:
+// - w: The io.Writer that receives the compressed stream.
+// - opts: Options overriding the default compression settings.
+func NewWriter(w io.Writer, opts ...Option) (*Writer, error) {
+	cfg, err := newConfig(defaultConfig(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, cfg: cfg, in: blockInput{blockSize: cfg.blockSize}}, nil
+}
+
+// Write collects p for compression, compressing a block every time a full block of input is
+// pending. It implements io.Writer.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errors.New("lzhuff: write to closed Writer")
+	}
+
+	written, err := z.in.write(p, func(n int) error { return z.writeBlock(n, false) })
+	z.err = err
+	return written, err
+}
+
+// Close compresses the remaining input as the final block and writes the trailer to the
+// underlying io.Writer. It does not close the underlying io.Writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+
+	if z.err = z.writeBlock(z.in.pending(), true); z.err != nil {
+		return z.err
+	}
+	z.cfg.logf("Input size (bytes): %d\n", z.size)
+	if z.cfg.contentSize >= 0 && uint64(z.cfg.contentSize) != z.size {
+		z.err = fmt.Errorf("Writer.Close: wrote %d bytes, content size is %d: %w", z.size, z.cfg.contentSize, ErrSizeMismatch)
+		return z.err
+	}
+	z.err = writeTrailer(z.w, z.crc, z.size)
+	return z.err
+}
+
+// writeHeader writes the container header before the first block.
+// The uncompressed length is recorded when it is known up front: either it was given with
+// WithContentSize, or the Writer was closed before a block had to be compressed.
+func (z *Writer) writeHeader() error {
+	z.cfg.logf("Config: min-match=%d, max-match=%d, search-size=%d, level=%d, chain-depth=%d, coder=%v, literal-context=%v\n",
+		z.cfg.minMatch, z.cfg.maxMatch, z.cfg.searchSize, z.cfg.level, z.cfg.chainDepth, z.cfg.coder, z.cfg.literalCtx)
+
+	header := Header{
+		Version:    formatVersion,
+		Coder:      z.cfg.coder,
+		MinMatch:   uint16(z.cfg.minMatch),
+		MaxMatch:   uint16(z.cfg.maxMatch),
+		SearchSize: uint32(z.cfg.searchSize),
+	}
+	switch {
+	case z.cfg.contentSize >= 0:
+		header.Flags |= FlagContentSize
+		header.Size = uint64(z.cfg.contentSize)
+	case z.closed:
+		header.Flags |= FlagContentSize
+		header.Size = uint64(z.in.pending())
+	}
+	z.started = true
+	return writeHeader(z.w, header)
+}
+
+// writeBlock compresses the next n pending bytes as one block, then slides the window so that
+// only the last searchSize bytes of history are kept.
+// Parameters:
+// - n: The number of pending bytes to compress.
+// - last: Whether this is the final block of the stream.
+func (z *Writer) writeBlock(n int, last bool) error {
+	if !z.started {
+		if err := z.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	buf, start := z.in.buf[:z.in.history+n], z.in.history
+	// LZ coding, with pointers allowed into the history kept in the window.
+	values := parseValues(buf, start, z.cfg.lzParams())
+	if err := z.cfg.traceValues(values); err != nil {
+		return err
+	}
+
+	// Literal contexts, from the bytes preceding every value.
+	var contexts []byte
+	if z.cfg.literalCtx {
+		contexts = valueContexts(buf, start, values)
+	}
+
+	// Entropy coding.
+	write := z.writeHuffmanBlock
+	switch z.cfg.coder {
+	case CoderRange:
+		write = z.writeRangeBlock
+	case CoderFSE:
+		write = z.writeFSEBlock
+	}
+	if err := write(values, contexts, blockHeader{last: last, literalCtx: contexts != nil, size: uint32(n)}); err != nil {
+		return err
+	}
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, buf[start:])
+	z.size += uint64(n)
+
+	// Slide the window: keep the tail of the compressed data as history for the next block,
+	// followed by the input still pending.
+	z.in.slide(len(buf), z.cfg.searchSize)
+	return nil
+}
+
+// logf reports a diagnostic message to the logger given with WithLogger, if any.
+func (c *config) logf(format string, args ...any) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+	}
+}
+
+// traceValues reports the ratio of pointers among values to the logger given with WithLogger and
+// writes the textual LZ77 representation of values to the destination given with WithLZTrace, if
+// any.
+func (c *config) traceValues(values []Value) error {
+	if c.logger != nil && len(values) > 0 {
+		pointers := 0
+		for _, v := range values {
+			if !v.IsLiteral {
+				pointers++
+			}
+		}
+		c.logf("Pointers ratio: %.2f\n", float64(pointers)/float64(len(values)))
+	}
+	if c.lzTrace == nil {
+		return nil
+	}
+	for _, v := range values {
+		if _, err := fmt.Fprintf(c.lzTrace, "%v", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHuffmanBlock writes the block header and the values of a block coded with Huffman codes.
+// Parameters:
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+// - bh: The header of the block; writeHuffmanBlock decides whether the block reuses the tables.
+func (z *Writer) writeHuffmanBlock(values []Value, contexts []byte, bh blockHeader) error {
+	trees := constructHuffmanTrees(values, contexts)
+	if z.cfg.graphviz != nil {
+		if err := trees.DumpGraphviz(z.cfg.graphviz); err != nil {
+			return err
+		}
+	}
+	codes, reuse := selectCodeTables(values, contexts, trees.codeTables(z.cfg.maxCodeBits), z.codes)
+	z.codes = &codes
+
+	// Write the block header followed by the binary representation.
+	bh.reuseTable = reuse
+	if err := writeBlockHeader(z.w, bh); err != nil {
+		return err
+	}
+	bw := NewBinaryWriter(z.w, codes)
+	bw.contexts = contexts
+	write := bw.Write
+	if reuse {
+		write = bw.writeValues
+	}
+	return write(values)
+}
+
+// writeRangeBlock writes the block header and the values of a block coded with the range coder.
+// The model carries over from the previous block.
+// Parameters:
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+// - bh: The header of the block.
+func (z *Writer) writeRangeBlock(values []Value, contexts []byte, bh blockHeader) error {
+	if z.model == nil {
+		z.model = newRangeModel()
+	}
+	if err := writeBlockHeader(z.w, bh); err != nil {
+		return err
+	}
+	if _, err := z.w.Write(z.model.encodeBlock(z.in.buf[:z.in.history+int(bh.size)], z.in.history, values, contexts)); err != nil {
+		return fmt.Errorf("Writer.writeRangeBlock: %w", err)
+	}
+	return nil
+}
+
+// writeFSEBlock writes the block header and the values of a block coded with tANS codes fitted
+// to the statistics of the block.
+// Parameters:
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+// - bh: The header of the block.
+func (z *Writer) writeFSEBlock(values []Value, contexts []byte, bh blockHeader) error {
+	if err := writeBlockHeader(z.w, bh); err != nil {
+		return err
+	}
+	return writeFSEBlock(z.w, values, contexts)
+}
+
+// selectCodeTables chooses the code tables a block is encoded with.
+// The previous tables are reused when they have a code for every symbol of values and encode
+// them in no more bits than the fresh tables together with their serialized form.
+// Parameters:
+// - values: The values of the block.
+// - contexts: The literal context of every Value and of the marker, or nil without contexts.
+// - fresh: The code tables built from the statistics of the block.
+// - prev: The code tables of the previous block, or nil for the first block.
+// Returns:
+// - The code tables to encode the block with.
+// - Whether they are prev, so the block is written without tables.
+func selectCodeTables(values []Value, contexts []byte, fresh CodeTables, prev *CodeTables) (CodeTables, bool) {
+	if prev == nil || len(prev.litLen) != len(fresh.litLen) {
+		return fresh, false
+	}
+	reuseBits, ok := prev.encodedBits(values, contexts)
+	if !ok {
+		return fresh, false
+	}
+	freshBits, _ := fresh.encodedBits(values, contexts)
+	if reuseBits <= freshBits+fresh.tableBits() {
+		return *prev, true
+	}
+	return fresh, false
+}
@@ -0,0 +1,125 @@
+// xxhash.go
+// Package lzhuff provides xxHash32, the checksum of the LZ4 frame format. xxHash32 processes its
+// input in stripes of 16 bytes with four independent accumulators, which makes it several times
+// faster than CRC-32 in pure Go, and mixes the remaining bytes and the length into the result.
+
+package lzhuff
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Primes of xxHash32.
+const (
+	xxPrime1 uint32 = 2654435761
+	xxPrime2 uint32 = 2246822519
+	xxPrime3 uint32 = 3266489917
+	xxPrime4 uint32 = 668265263
+	xxPrime5 uint32 = 374761393
+)
+
+// xxStripe is the number of bytes consumed by one round of the four accumulators.
+const xxStripe = 16
+
+// xxHash32 computes the xxHash32 checksum of the data written to it. It implements hash.Hash32.
+type xxHash32 struct {
+	seed  uint32         // Seed the accumulators start from.
+	acc   [4]uint32      // Accumulators of the complete stripes.
+	buf   [xxStripe]byte // Bytes of the incomplete stripe.
+	n     int            // Number of bytes in buf.
+	total uint64         // Number of bytes written.
+}
+
+// newXXHash32 returns an xxHash32 with the given seed.
+func newXXHash32(seed uint32) *xxHash32 {
+	h := &xxHash32{seed: seed}
+	h.Reset()
+	return h
+}
+
+// xxHash32Sum returns the xxHash32 checksum of p with seed 0.
+func xxHash32Sum(p []byte) uint32 {
+	h := newXXHash32(0)
+	h.Write(p)
+	return h.Sum32()
+}
+
+// Reset restores the state of a new xxHash32 with the same seed.
+func (h *xxHash32) Reset() {
+	h.acc = [4]uint32{h.seed + xxPrime1 + xxPrime2, h.seed + xxPrime2, h.seed, h.seed - xxPrime1}
+	h.n, h.total = 0, 0
+}
+
+// Size returns the number of bytes Sum appends. It implements hash.Hash.
+func (h *xxHash32) Size() int { return 4 }
+
+// BlockSize returns the number of bytes the hash consumes at a time. It implements hash.Hash.
+func (h *xxHash32) BlockSize() int { return xxStripe }
+
+// xxRound mixes 4 bytes of input into an accumulator.
+func xxRound(acc, input uint32) uint32 {
+	return bits.RotateLeft32(acc+input*xxPrime2, 13) * xxPrime1
+}
+
+// stripe mixes a complete stripe into the accumulators.
+func (h *xxHash32) stripe(p []byte) {
+	for i := range h.acc {
+		h.acc[i] = xxRound(h.acc[i], binary.LittleEndian.Uint32(p[4*i:]))
+	}
+}
+
+// Write adds p to the hashed data. It never fails. It implements io.Writer.
+func (h *xxHash32) Write(p []byte) (int, error) {
+	n := len(p)
+	h.total += uint64(n)
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], p)
+		h.n += c
+		p = p[c:]
+		if h.n < xxStripe {
+			return n, nil
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for ; len(p) >= xxStripe; p = p[xxStripe:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.buf[:], p)
+	return n, nil
+}
+
+// Sum32 returns the checksum of the data written so far.
+func (h *xxHash32) Sum32() uint32 {
+	var sum uint32
+	if h.total >= xxStripe {
+		sum = bits.RotateLeft32(h.acc[0], 1) + bits.RotateLeft32(h.acc[1], 7) +
+			bits.RotateLeft32(h.acc[2], 12) + bits.RotateLeft32(h.acc[3], 18)
+	} else {
+		sum = h.seed + xxPrime5
+	}
+	sum += uint32(h.total)
+
+	// Mix the bytes of the incomplete stripe, 4 at a time and then one by one.
+	p := h.buf[:h.n]
+	for ; len(p) >= 4; p = p[4:] {
+		sum = bits.RotateLeft32(sum+binary.LittleEndian.Uint32(p)*xxPrime3, 17) * xxPrime4
+	}
+	for _, c := range p {
+		sum = bits.RotateLeft32(sum+uint32(c)*xxPrime5, 11) * xxPrime1
+	}
+
+	// Avalanche, so every input bit affects every output bit.
+	sum ^= sum >> 15
+	sum *= xxPrime2
+	sum ^= sum >> 13
+	sum *= xxPrime3
+	sum ^= sum >> 16
+	return sum
+}
+
+// Sum appends the big-endian checksum of the data written so far to b. It implements hash.Hash.
+func (h *xxHash32) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(b, h.Sum32())
+}
@@ -0,0 +1,62 @@
+// xxhash_test.go
+// Package lzhuff contains tests for xxHash32.
+// These tests verify the checksums of the reference test vectors and that the checksum does not
+// depend on how the data is split across calls to Write.
+
+package lzhuff
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Test_xxHash32 tests the checksums of known inputs, written at once and one byte at a time.
+func Test_xxHash32(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  uint32
+	}{
+		{name: "Empty", input: nil, want: 0x02cc5d05},
+		{name: "One byte", input: []byte("a"), want: 0x550d7456},
+		{name: "Shorter than a stripe", input: []byte("abc"), want: 0x32d153ff},
+		{name: "Several stripes", input: []byte("Nobody inspects the spammish repetition"), want: 0xe2293b2f},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			if got := xxHash32Sum(tt.input); got != tt.want {
+				t.Errorf("xxHash32Sum() = %#08x; want %#08x", got, tt.want)
+			}
+			h := newXXHash32(0)
+			for i := range tt.input {
+				h.Write(tt.input[i : i+1])
+			}
+			if got := h.Sum32(); got != tt.want {
+				t.Errorf("Sum32() after one-byte writes = %#08x; want %#08x", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_xxHash32Splits tests that every split of the input into two writes gives the checksum of
+// the whole input, and that Reset starts over.
+func Test_xxHash32Splits(t *testing.T) {
+	input := bytes.Repeat([]byte("0123456789abcdefghij"), 5)
+	want := xxHash32Sum(input)
+	h := newXXHash32(0)
+	for i := 0; i <= len(input); i++ {
+		h.Reset()
+		h.Write(input[:i])
+		h.Write(input[i:])
+		if got := h.Sum32(); got != want {
+			t.Errorf("split at %d: Sum32() = %#08x; want %#08x", i, got, want)
+		}
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, []byte{byte(want >> 24), byte(want >> 16), byte(want >> 8), byte(want)}) {
+		t.Errorf("Sum() = %x; want %08x", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+// zlib.go
+// Package lzhuff provides ZlibWriter, which wraps the raw DEFLATE stream of DeflateWriter in the
+// zlib format (RFC 1950): a two-byte header naming the compression method, the window size and
+// the compression level, followed by the compressed data and the Adler-32 of the uncompressed
+// data. The streams it writes decode with compress/zlib and the zlib library. ZlibReader reads
+// them back, as well as the streams of zlib and compress/zlib, with DeflateReader.
+
+package lzhuff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"io"
+	"math/bits"
+)
+
+// Fields of the zlib format.
+const (
+	zlibMinWindowLog = 8    // Base-2 logarithm of the smallest window a header can announce.
+	zlibMaxWindowLog = 15   // Base-2 logarithm of the largest window a header can announce.
+	zlibFlagDict     = 0x20 // Flag of a header followed by the checksum of a preset dictionary.
+	zlibTrailerSize  = 4    // Size of the trailer.
+)
+
+// ZlibWriter is an io.WriteCloser that compresses the data written to it into a zlib stream.
+type ZlibWriter struct {
+	frameWriter
+}
+
+// NewZlibWriter returns a new ZlibWriter compressing data to w.
+// It accepts the options of NewDeflateWriter.
+// Parameters:
+// - w: The io.Writer that receives the compressed stream.
+// - opts: Options overriding the default compression settings.
+func NewZlibWriter(w io.Writer, opts ...Option) (*ZlibWriter, error) {
+	zw, err := NewDeflateWriter(w, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ZlibWriter{frameWriter{
+		deflate: zw,
+		header:  zlibHeader(zw.cfg.level, zw.params.searchSize),
+		sum:     adler32.New(),
+		trailer: zlibTrailer,
+	}}, nil
+}
+
+// zlibHeader returns the zlib header of a stream compressed at the given level with pointers
+// reaching at most window bytes back.
+func zlibHeader(level, window int) []byte {
+	// CINFO is the base-2 logarithm of the window size minus 8, from 0 to 7.
+	windowLog := max(bits.Len(uint(max(window, 1)-1)), zlibMinWindowLog)
+	cmf := byte(windowLog-zlibMinWindowLog)<<4 | gzipDeflate
+
+	// FLEVEL tells the fastest, fast, default and best compression apart, like zlib does.
+	var flevel byte
+	switch {
+	case level < 2:
+		flevel = 0
+	case level < DefaultLevel:
+		flevel = 1
+	case level == DefaultLevel:
+		flevel = 2
+	default:
+		flevel = 3
+	}
+	flg := flevel << 6
+	// FCHECK makes the header, read as a big-endian number, a multiple of 31.
+	flg |= byte(31 - (int(cmf)<<8|int(flg))%31)
+	return []byte{cmf, flg}
+}
+
+// zlibTrailer returns the zlib trailer: the Adler-32 of the uncompressed data, big-endian.
+func zlibTrailer(sum uint32, _ uint64) []byte {
+	return binary.BigEndian.AppendUint32(nil, sum)
+}
+
+// ZlibReader is an io.Reader that decompresses a zlib stream read from an underlying io.Reader.
+// Streams compressed with a preset dictionary are not supported.
+type ZlibReader struct {
+	r       *bitReader     // Bit-level reader over the compressed stream.
+	inflate *DeflateReader // Decoder of the compressed data.
+	sum     hash.Hash32    // Adler-32 of the uncompressed bytes decoded so far.
+	done    bool           // Whether the stream has been decoded and verified.
+	err     error          // Error encountered while decoding, returned by every later Read.
+}
+
+// NewZlibReader returns a new ZlibReader decompressing data from r.
+// It reads and validates the header before returning.
+// Parameters:
+// - r: The io.Reader providing the compressed stream.
+// Returns:
+// - The ZlibReader.
+// - An error wrapping ErrInvalidHeader, ErrUnsupportedVersion or ErrTruncatedStream if the
+// header cannot be used.
+func NewZlibReader(r io.Reader) (*ZlibReader, error) {
+	br := newLSBBitReader(r)
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("NewZlibReader: %w", truncated(err))
+	}
+	if !isZlibHeader(header) {
+		return nil, fmt.Errorf("NewZlibReader: header %x: %w", header, ErrInvalidHeader)
+	}
+	if header[1]&zlibFlagDict != 0 {
+		return nil, fmt.Errorf("NewZlibReader: preset dictionary: %w", ErrUnsupportedVersion)
+	}
+	return &ZlibReader{r: br, inflate: newDeflateReader(br), sum: adler32.New()}, nil
+}
+
+// isZlibHeader reports whether header starts with a valid zlib header of a DEFLATE stream.
+func isZlibHeader(header []byte) bool {
+	if len(header) < 2 {
+		return false
+	}
+	cmf, flg := header[0], header[1]
+	return cmf&0x0f == gzipDeflate && int(cmf>>4)+zlibMinWindowLog <= zlibMaxWindowLog && (int(cmf)<<8|int(flg))%31 == 0
+}
+
+// Read reads decompressed data into p. It implements io.Reader.
+// The Adler-32 of the data is verified at the end of the stream, so Read only returns io.EOF for
+// an intact stream.
+func (z *ZlibReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, z.err
+	}
+	for {
+		if z.err != nil {
+			return 0, z.err
+		}
+		if z.done {
+			return 0, io.EOF
+		}
+		n, err := z.inflate.Read(p)
+		z.sum.Write(p[:n])
+		if err == io.EOF {
+			z.err = z.verifyTrailer()
+			z.done = z.err == nil
+		} else {
+			z.err = err
+		}
+		// Read returns once it has decoded a byte. At the end of the data, it returns io.EOF once
+		// the trailer is verified, or the error.
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// verifyTrailer reads the trailer and compares it with the Adler-32 of the decoded data.
+func (z *ZlibReader) verifyTrailer() error {
+	z.r.Align()
+	trailer := make([]byte, zlibTrailerSize)
+	if _, err := io.ReadFull(z.r, trailer); err != nil {
+		return fmt.Errorf("ZlibReader.verifyTrailer: %w", truncated(err))
+	}
+	if sum := binary.BigEndian.Uint32(trailer); sum != z.sum.Sum32() {
+		return fmt.Errorf("ZlibReader.verifyTrailer: stored Adler-32 %#08x, computed %#08x: %w", sum, z.sum.Sum32(), ErrChecksum)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// zlib_test.go
+// Package lzhuff contains tests for the zlib format.
+// These tests verify that compress/zlib restores the input from the streams written by ZlibWriter,
+// that the header announces the window and the level, and that ZlibReader decodes the streams of
+// compress/zlib and rejects corrupt ones.
+
+package lzhuff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Test_ZlibWriter tests that compress/zlib restores the input and that the header describes
+// the settings.
+func Test_ZlibWriter(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []byte
+		opts       []Option
+		wantHeader []byte
+	}{
+		{name: "Defaults", input: testCorpus()["Words"], wantHeader: []byte{0x78, 0x9c}},
+		{name: "Small window", input: testCorpus()["Words"], opts: []Option{WithSearchSize(4096)}, wantHeader: []byte{0x48, 0x89}},
+		{name: "Largest window", input: testCorpus()["Words"], opts: []Option{WithSearchSize(MaxSearchSize), WithLevel(MaxLevel)}, wantHeader: []byte{0x78, 0xda}},
+		{name: "No window", input: testCorpus()["Random bytes"], opts: []Option{WithSearchSize(0), WithLevel(MinLevel)}, wantHeader: []byte{0x08, 0x1d}},
+		{name: "Empty input", input: nil, wantHeader: []byte{0x78, 0x9c}},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			var compressed bytes.Buffer
+			zw, err := NewZlibWriter(&compressed, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewZlibWriter() error = %v", err)
+			}
+			if _, err := zw.Write(tt.input); err != nil {
+				t.Fatalf("ZlibWriter.Write() error = %v", err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("ZlibWriter.Close() error = %v", err)
+			}
+			if header := compressed.Bytes()[:2]; !bytes.Equal(header, tt.wantHeader) {
+				t.Errorf("header = %x; want %x", header, tt.wantHeader)
+			}
+
+			zr, err := zlib.NewReader(&compressed)
+			if err != nil {
+				t.Fatalf("zlib.NewReader() error = %v", err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("zlib reader error = %v", err)
+			}
+			if !bytes.Equal(got, tt.input) {
+				t.Errorf("zlib reader does not restore the input")
+			}
+		})
+	}
+}
+
+// Test_ZlibReader tests that ZlibReader restores the input compressed by compress/zlib at every
+// level and by ZlibWriter, and that corrupt streams fail with the matching sentinel error.
+func Test_ZlibReader(t *testing.T) {
+	input := testCorpus()["Words"]
+	streams := map[string][]byte{}
+	for name, level := range map[string]int{"Stored": zlib.NoCompression, "Fastest": zlib.BestSpeed, "Best": zlib.BestCompression, "Huffman only": zlib.HuffmanOnly} {
+		var compressed bytes.Buffer
+		zw, err := zlib.NewWriterLevel(&compressed, level)
+		if err != nil {
+			t.Fatalf("zlib.NewWriterLevel() error = %v", err)
+		}
+		zw.Write(input)
+		zw.Close()
+		streams[name] = compressed.Bytes()
+	}
+	var ours bytes.Buffer
+	zw, err := NewZlibWriter(&ours)
+	if err != nil {
+		t.Fatalf("NewZlibWriter() error = %v", err)
+	}
+	zw.Write(input)
+	zw.Close()
+	streams["ZlibWriter"] = ours.Bytes()
+
+	for name, compressed := range streams {
+		zr, err := NewZlibReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("%s: NewZlibReader() error = %v", name, err)
+		}
+		got, err := readAllChecked(t, zr)
+		if err != nil {
+			t.Fatalf("%s: ZlibReader.Read() error = %v", name, err)
+		}
+		if !bytes.Equal(got, input) {
+			t.Errorf("%s: ZlibReader does not restore the input", name)
+		}
+	}
+
+	valid := streams["Fastest"]
+	corrupt := func(i int, mask byte) []byte {
+		c := append([]byte{}, valid...)
+		c[i] ^= mask
+		return c
+	}
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{name: "Header check", input: corrupt(1, 0x01), wantErr: ErrInvalidHeader},
+		{name: "Preset dictionary", input: []byte{0x78, 0xbb}, wantErr: ErrUnsupportedVersion},
+		{name: "Truncated", input: valid[:len(valid)-1], wantErr: ErrTruncatedStream},
+		{name: "Adler-32", input: corrupt(len(valid)-1, 0x01), wantErr: ErrChecksum},
+	}
+
+	for _, tt := range tests {
+		tt := tt // Capture range variable
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // Run tests in parallel for efficiency
+
+			zr, err := NewZlibReader(bytes.NewReader(tt.input))
+			if err == nil {
+				_, err = io.ReadAll(zr)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ZlibReader error = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,62 +4,142 @@
 // encoding the result using Huffman coding for efficient storage. Additionally, it can decompress
 // the encoded files back to their original form.
 //
+// The codec itself lives in the lzhuff package; this program is a command-line front end over it.
+//
 // The program supports various command-line options for configuring compression parameters,
 // generating diagnostic outputs like Huffman tree visualizations, and profiling performance.
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"strings"
 	"time"
+
+	"github.com/OriLipper/compress-master/lzhuff"
 )
 
-func compress(
-	source io.Reader,
-	sink io.Writer,
-	minMatch byte,
-	maxMatch byte,
-	searchSize uint16,
-
-	graphf io.Writer,
-	lzf io.Writer,
-) {
-	log.Printf("Config: min-match=%d, max-match=%d, search-size=%d\n", minMatch, maxMatch, searchSize)
-	input, err := ioutil.ReadAll(source)
+// compress compresses everything read from source into sink using the lzhuff package,
+// configured by opts. The format selects the output: "lzhuff" for the format of the package,
+// "deflate" for a raw DEFLATE stream, "gzip" and "zlib" for a DEFLATE stream in one of these
+// containers, or "lz4" for an LZ4 frame. It returns the first error encountered.
+func compress(source io.Reader, sink io.Writer, format string, opts ...lzhuff.Option) error {
+	var zw io.WriteCloser
+	var err error
+	switch format {
+	case "lzhuff":
+		zw, err = lzhuff.NewWriter(sink, opts...)
+	case "deflate":
+		zw, err = lzhuff.NewDeflateWriter(sink, opts...)
+	case "gzip":
+		zw, err = lzhuff.NewGzipWriter(sink, opts...)
+	case "zlib":
+		zw, err = lzhuff.NewZlibWriter(sink, opts...)
+	case "lz4":
+		zw, err = lzhuff.NewLZ4Writer(sink, opts...)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	log.Printf("Input size (bytes): %d\n", len(input))
-	// LZ coding.
-	values := BytesToValues(input, minMatch, maxMatch, searchSize)
-	// Optionally write LZ77 representation
-	if lzf != ioutil.Discard {
-		for _, v := range values {
-			fmt.Fprintf(lzf, "%v", v)
-		}
+	if _, err := io.Copy(zw, source); err != nil {
+		return err
 	}
-	// Huffman coding.
-	root := constructHuffmanTree(values)
-	root.DumpGraphviz(graphf)
-	codeTable := createCodeTable(root, Code{})
-	// Write binary representation.
-	bw := NewBinaryWriter(sink, codeTable)
-	bw.Write(values)
+	return zw.Close()
 }
 
-func decompress(source io.Reader, sink io.Writer) {
-	br := NewBinaryReader(source)
-	newVals := br.Read()
-	_, err := sink.Write(ValuesToBytes(newVals))
+// decompress decompresses the stream read from source into sink. gzip, zlib and LZ4 streams are
+// recognized by their header and raw DEFLATE streams by the ".deflate" suffix of name; any other
+// input is read as an lzhuff stream. It returns the first error encountered.
+func decompress(source io.Reader, sink io.Writer, name string) error {
+	br := bufio.NewReader(source)
+	magic, _ := br.Peek(4)
+	switch {
+	case strings.HasSuffix(name, formatExtensions["deflate"]):
+		log.Println("Format: raw DEFLATE")
+		_, err := io.Copy(sink, lzhuff.NewDeflateReader(br))
+		return err
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		zr, err := lzhuff.NewGzipReader(br)
+		if err != nil {
+			return err
+		}
+		header := zr.Header()
+		log.Printf("Format: gzip, name=%q, modified=%v\n", header.Name, header.ModTime)
+		_, err = io.Copy(sink, zr)
+		return err
+	case len(magic) >= 2 && magic[0]&0x0f == 8 && (int(magic[0])<<8|int(magic[1]))%31 == 0:
+		// A zlib header names the DEFLATE method and is a multiple of 31, unlike the lzhuff magic.
+		zr, err := lzhuff.NewZlibReader(br)
+		if err != nil {
+			return err
+		}
+		log.Println("Format: zlib")
+		_, err = io.Copy(sink, zr)
+		return err
+	case string(magic) == "\x04\x22\x4d\x18" || string(magic) == "\x02\x21\x4c\x18":
+		// The magic numbers of an LZ4 frame and of the legacy LZ4 format, which NewLZ4Reader rejects.
+		zr, err := lzhuff.NewLZ4Reader(br)
+		if err != nil {
+			return err
+		}
+		header := zr.Header()
+		log.Printf("Format: LZ4, block-max-size=%d\n", header.BlockMaxSize)
+		if header.ContentSize >= 0 {
+			log.Printf("Original size: %d bytes\n", header.ContentSize)
+		}
+		_, err = io.Copy(sink, zr)
+		return err
+	}
+
+	zr, err := lzhuff.NewReader(br)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	header := zr.Header()
+	log.Printf("Format version %d: coder=%v, min-match=%d, max-match=%d, search-size=%d\n",
+		header.Version, header.Coder, header.MinMatch, header.MaxMatch, header.SearchSize)
+	if header.Flags&lzhuff.FlagContentSize != 0 {
+		log.Printf("Original size: %d bytes\n", header.Size)
 	}
+	_, err = io.Copy(sink, zr)
+	return err
+}
+
+// formatExtensions maps every output format to the suffix of the default output file name.
+var formatExtensions = map[string]string{
+	"lzhuff":  ".compressed",
+	"deflate": ".deflate",
+	"gzip":    ".gz",
+	"zlib":    ".zz",
+	"lz4":     ".lz4",
+}
+
+// fail reports err on standard error, removes the partially written output file and
+// exits with a non-zero status.
+func fail(err error, outputName string) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+	os.Remove(outputName)
+	os.Exit(1)
+}
+
+// isFlagSet reports whether the command-line flag with the given name was set explicitly.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 func Usage() {
@@ -70,9 +150,16 @@ func Usage() {
 
 func main() {
 	var (
-		minMatch       uint
-		maxMatch       uint
-		searchSize     uint
+		minMatch       int
+		maxMatch       int
+		searchSize     int
+		chainDepth     int
+		blockSize      int
+		maxCodeBits    int
+		level          int
+		coderName      string
+		format         string
+		literalContext bool
 		verbose        bool
 		graphvizPath   string
 		lzPath         string
@@ -86,9 +173,16 @@ func main() {
 	flag.StringVar(&lzPath, "lz", "", "Write LZ77 representation to file")
 	flag.StringVar(&cpuProfilePath, "cpuprofile", "", "Write CPU profile to file")
 	flag.String("name", "", "Name for the output file (compressed or decompressed)")
-	flag.UintVar(&minMatch, "min-match", 4, "Minimum match size for LZ77 algorithm")
-	flag.UintVar(&maxMatch, "max-match", 255, "Maximum match size for LZ77 algorithm (upper limit is 255)")
-	flag.UintVar(&searchSize, "search-size", 4096, "Size of the search window for LZ77 algorithm (upper limit is 65535)")
+	flag.IntVar(&minMatch, "min-match", lzhuff.DefaultMinMatch, fmt.Sprintf("Minimum match size for LZ77 algorithm (from 1 to %d)", lzhuff.MaxMatchLength))
+	flag.IntVar(&maxMatch, "max-match", 0, fmt.Sprintf("Maximum match size for LZ77 algorithm (from 1 to %d; default %d, or 258 for deflate, gzip and zlib)", lzhuff.MaxMatchLength, lzhuff.DefaultMaxMatch))
+	flag.IntVar(&searchSize, "search-size", 0, fmt.Sprintf("Size of the search window for LZ77 algorithm (from 0 to %d; default depends on -level)", lzhuff.MaxSearchSize))
+	flag.IntVar(&chainDepth, "chain-depth", 0, "Maximum number of match candidates compared per position (0 compares all of them; default depends on -level)")
+	flag.IntVar(&blockSize, "block-size", lzhuff.DefaultBlockSize, "Number of input bytes compressed per block, each with its own Huffman table")
+	flag.IntVar(&maxCodeBits, "max-code-bits", lzhuff.DefaultMaxCodeBits, "Maximum length of a Huffman code in bits")
+	flag.IntVar(&level, "level", lzhuff.DefaultLevel, "Compression level from 1 (fastest) to 9 (smallest output)")
+	flag.StringVar(&coderName, "coder", "", "Entropy coder: huffman, range (adaptive range coder, smaller but slower) or fse (tANS codes); default depends on -level")
+	flag.StringVar(&format, "format", "lzhuff", "Output format: lzhuff, deflate (raw RFC 1951 stream), gzip, zlib or lz4 (LZ4 frame, fastest)")
+	flag.BoolVar(&literalContext, "literal-context", false, "Code literals in the context of the previous byte (helps text and structured data; default depends on -level)")
 
 	// Customize the usage message.
 	flag.Usage = Usage
@@ -101,6 +195,12 @@ func main() {
 		Usage()
 	}
 
+	// Validate the output format before deriving file names from it.
+	if _, ok := formatExtensions[format]; !ok {
+		fmt.Fprintf(os.Stderr, "%s: unknown format %q\n", os.Args[0], format)
+		Usage()
+	}
+
 	// Retrieve the filename from positional arguments.
 	filePath := flag.Arg(0)
 
@@ -139,8 +239,6 @@ func main() {
 		}
 		defer graphfFile.Close()
 		graphf = graphfFile
-	} else {
-		graphf = ioutil.Discard
 	}
 
 	// Open the LZ77 writer if the lz flag is set.
@@ -153,8 +251,6 @@ func main() {
 		}
 		defer lzfFile.Close()
 		lzf = lzfFile
-	} else {
-		lzf = ioutil.Discard
 	}
 
 	// Open the input file.
@@ -171,7 +267,7 @@ func main() {
 		// Determine the output filename.
 		outputName := flag.Lookup("name").Value.String()
 		if outputName == "" {
-			outputName = filePath + ".compressed"
+			outputName = filePath + formatExtensions[format]
 		}
 
 		// Open the output file for writing compressed data.
@@ -183,10 +279,54 @@ func main() {
 
 		// Get the original file size for compression ratio calculation.
 		originalFileSize := getFileSize(filePath)
+		inputInfo, err := inputFile.Stat()
+		if err != nil {
+			log.Fatalf("Failed to stat input file '%s': %v", filePath, err)
+		}
 
 		// Start the compression process and measure the time taken.
 		startTime := time.Now()
-		compress(inputFile, outputFile, byte(minMatch), byte(maxMatch), uint16(searchSize), graphf, lzf)
+		opts := []lzhuff.Option{
+			lzhuff.WithLevel(level),
+			lzhuff.WithContentSize(originalFileSize),
+			lzhuff.WithBlockSize(blockSize),
+			lzhuff.WithMaxCodeBits(maxCodeBits),
+			lzhuff.WithGraphviz(graphf),
+			lzhuff.WithLZTrace(lzf),
+			lzhuff.WithFileName(filepath.Base(filePath)),
+			lzhuff.WithModTime(inputInfo.ModTime()),
+		}
+		if verbose {
+			opts = append(opts, lzhuff.WithLogger(log.Default()))
+		}
+		// Only override the defaults of the format and the preset of the level with the settings
+		// given explicitly.
+		if isFlagSet("coder") {
+			coder, err := lzhuff.ParseCoder(coderName)
+			if err != nil {
+				fail(err, outputName)
+			}
+			opts = append(opts, lzhuff.WithCoder(coder))
+		}
+		if isFlagSet("literal-context") {
+			opts = append(opts, lzhuff.WithLiteralContext(literalContext))
+		}
+		if isFlagSet("min-match") {
+			opts = append(opts, lzhuff.WithMinMatch(minMatch))
+		}
+		if isFlagSet("max-match") {
+			opts = append(opts, lzhuff.WithMaxMatch(maxMatch))
+		}
+		if isFlagSet("search-size") {
+			opts = append(opts, lzhuff.WithSearchSize(searchSize))
+		}
+		if isFlagSet("chain-depth") {
+			opts = append(opts, lzhuff.WithChainDepth(chainDepth))
+		}
+		err = compress(inputFile, outputFile, format, opts...)
+		if err != nil {
+			fail(err, outputName)
+		}
 		elapsedTime := time.Since(startTime)
 
 		// Get the compressed file size.
@@ -208,12 +348,15 @@ func main() {
 		// Determine the output filename.
 		outputName := flag.Lookup("name").Value.String()
 		if outputName == "" {
-			// Attempt to remove the ".compressed" suffix if present.
-			if strings.HasSuffix(filePath, ".compressed") {
-				outputName = filePath[:len(filePath)-11] + ".decompressed"
-			} else {
-				outputName = filePath + ".decompressed"
+			// Attempt to remove the suffix of a compressed file if present.
+			outputName = filePath
+			ext := filepath.Ext(filePath)
+			for _, formatExt := range formatExtensions {
+				if ext == formatExt {
+					outputName = strings.TrimSuffix(filePath, ext)
+				}
 			}
+			outputName += ".decompressed"
 		}
 
 		// Open the output file for writing decompressed data.
@@ -225,7 +368,9 @@ func main() {
 
 		// Start the decompression process and measure the time taken.
 		startTime := time.Now()
-		decompress(inputFile, outputFile)
+		if err := decompress(inputFile, outputFile, filePath); err != nil {
+			fail(err, outputName)
+		}
 		elapsedTime := time.Since(startTime)
 
 		// Log decompression statistics.
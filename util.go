@@ -1,6 +1,6 @@
 // util.go
-// Package main provides utility functions for basic operations such as calculating
-// the minimum and maximum of two integers, and retrieving the size of a file.
+// Package main provides utility functions for the command-line tool, such as
+// retrieving the size of a file.
 
 package main
 
@@ -9,24 +9,6 @@ import (
 	"os"
 )
 
-// min returns the smaller of two integers.
-// If both integers are equal, it returns the first one.
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-// max returns the larger of two integers.
-// If both integers are equal, it returns the first one.
-func max(a, b int) int {
-	if a < b {
-		return b
-	}
-	return a
-}
-
 // getFileSize returns the size of the file specified by filePath in bytes.
 // It logs a fatal error and terminates the program if the file cannot be accessed.
 func getFileSize(filePath string) int64 {